@@ -0,0 +1,354 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffAlgorithms are the supported values for --diff-algorithm.
+var diffAlgorithms = []string{"myers", "minimal", "patience", "histogram"}
+
+// histogramMaxChain skips lines that repeat more often than this when
+// looking for a split point, the same limit git uses.
+const histogramMaxChain = 64
+
+// lineDiffer computes diffs between two sequences of lines, each line is
+// represented by a single rune as produced by linesToRunes.
+type lineDiffer struct {
+	diffs []diffmatchpatch.Diff
+}
+
+// validDiffAlgorithm reports if name is one of diffAlgorithms.
+func validDiffAlgorithm(name string) bool {
+	for _, algorithm := range diffAlgorithms {
+		if algorithm == name {
+			return true
+		}
+	}
+	return false
+}
+
+// diffRunes diffs a against b with the named algorithm, unknown names use myers.
+// The result has the same shape as diffmatchpatch.DiffMainRunes, one rune per line.
+func diffRunes(dmp *diffmatchpatch.DiffMatchPatch, algorithm string, a []rune, b []rune) []diffmatchpatch.Diff {
+	differ := &lineDiffer{}
+	switch algorithm {
+	case "minimal":
+		differ.myers(a, b, 0)
+	case "patience":
+		differ.patience(a, b)
+	case "histogram":
+		differ.histogram(a, b)
+	default:
+		differ.myers(a, b, myersCostLimit(len(a)+len(b)))
+	}
+	return dmp.DiffCleanupMerge(differ.diffs)
+}
+
+// myersCostLimit is how many edits myers explores before settling for a
+// good enough split point, like xdiff it grows with the square root of the input.
+func myersCostLimit(size int) int {
+	limit := int(math.Sqrt(float64(size + 3)))
+	if limit < 256 {
+		limit = 256
+	}
+	return limit
+}
+
+func (differ *lineDiffer) add(diffType diffmatchpatch.Operation, lines []rune) {
+	if len(lines) == 0 {
+		return
+	}
+	differ.diffs = appendDiff(differ.diffs, diffmatchpatch.Diff{Type: diffType, Text: string(lines)})
+}
+
+// trim emits the common prefix of a and b and returns what is left along
+// with the common suffix, which the caller emits once it is done.
+func (differ *lineDiffer) trim(a []rune, b []rune) ([]rune, []rune, []rune) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	differ.add(diffmatchpatch.DiffEqual, a[:prefix])
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-suffix-1] == b[len(b)-suffix-1] {
+		suffix++
+	}
+	return a[:len(a)-suffix], b[:len(b)-suffix], a[len(a)-suffix:]
+}
+
+// changed emits a and b as changes if either is empty and reports if it did.
+func (differ *lineDiffer) changed(a []rune, b []rune) bool {
+	if len(a) == 0 || len(b) == 0 {
+		differ.add(diffmatchpatch.DiffDelete, a)
+		differ.add(diffmatchpatch.DiffInsert, b)
+		return true
+	}
+	return false
+}
+
+// myers is Myers' O(ND) algorithm using the linear space middle snake
+// refinement. A costLimit of 0 always finds a minimal diff.
+func (differ *lineDiffer) myers(a []rune, b []rune, costLimit int) {
+	a, b, suffix := differ.trim(a, b)
+	if !differ.changed(a, b) {
+		x, y, found := middleSnake(a, b, costLimit)
+		if !found {
+			differ.add(diffmatchpatch.DiffDelete, a)
+			differ.add(diffmatchpatch.DiffInsert, b)
+		} else {
+			differ.myers(a[:x], b[:y], costLimit)
+			differ.myers(a[x:], b[y:], costLimit)
+		}
+	}
+	differ.add(diffmatchpatch.DiffEqual, suffix)
+}
+
+// middleSnake walks the edit graph from both ends until the paths meet and
+// returns where to split the problem. Once costLimit edits have been explored
+// the furthest point reached by the forward path is used instead.
+func middleSnake(a []rune, b []rune, costLimit int) (int, int, bool) {
+	lenA, lenB := len(a), len(b)
+	maxD := (lenA + lenB + 1) / 2
+	vOffset := maxD
+	vLength := 2*maxD + 2
+
+	v1 := make([]int, vLength)
+	v2 := make([]int, vLength)
+	for i := range v1 {
+		v1[i] = -1
+		v2[i] = -1
+	}
+	v1[vOffset+1] = 0
+	v2[vOffset+1] = 0
+
+	delta := lenA - lenB
+	// If the total number of lines is odd, the forward path collides with the reverse path.
+	front := delta%2 != 0
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+	bestX, bestY := 0, 0
+
+	for d := 0; d < maxD; d++ {
+		if costLimit > 0 && d > costLimit && bestX+bestY > 0 {
+			return bestX, bestY, true
+		}
+
+		for k1 := -d + k1start; k1 <= d-k1end; k1 += 2 {
+			k1Offset := vOffset + k1
+			var x1 int
+			if k1 == -d || (k1 != d && v1[k1Offset-1] < v1[k1Offset+1]) {
+				x1 = v1[k1Offset+1]
+			} else {
+				x1 = v1[k1Offset-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < lenA && y1 < lenB && a[x1] == b[y1] {
+				x1++
+				y1++
+			}
+			v1[k1Offset] = x1
+			if x1 > lenA {
+				k1end += 2
+			} else if y1 > lenB {
+				k1start += 2
+			} else {
+				if x1+y1 > bestX+bestY && x1+y1 < lenA+lenB {
+					bestX, bestY = x1, y1
+				}
+				if front {
+					k2Offset := vOffset + delta - k1
+					if k2Offset >= 0 && k2Offset < vLength && v2[k2Offset] != -1 && x1 >= lenA-v2[k2Offset] {
+						return x1, y1, true
+					}
+				}
+			}
+		}
+
+		for k2 := -d + k2start; k2 <= d-k2end; k2 += 2 {
+			k2Offset := vOffset + k2
+			var x2 int
+			if k2 == -d || (k2 != d && v2[k2Offset-1] < v2[k2Offset+1]) {
+				x2 = v2[k2Offset+1]
+			} else {
+				x2 = v2[k2Offset-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < lenA && y2 < lenB && a[lenA-x2-1] == b[lenB-y2-1] {
+				x2++
+				y2++
+			}
+			v2[k2Offset] = x2
+			if x2 > lenA {
+				k2end += 2
+			} else if y2 > lenB {
+				k2start += 2
+			} else if !front {
+				k1Offset := vOffset + delta - k2
+				if k1Offset >= 0 && k1Offset < vLength && v1[k1Offset] != -1 {
+					x1 := v1[k1Offset]
+					y1 := vOffset + x1 - k1Offset
+					if x1 >= lenA-x2 {
+						return x1, y1, true
+					}
+				}
+			}
+		}
+	}
+
+	// Nothing in common
+	return 0, 0, false
+}
+
+// patience anchors the diff on lines that appear exactly once on both
+// sides, keeping the longest run of them that is in the same order.
+// Ranges without unique lines fall back to myers.
+func (differ *lineDiffer) patience(a []rune, b []rune) {
+	a, b, suffix := differ.trim(a, b)
+	if !differ.changed(a, b) {
+		anchors := patienceAnchors(a, b)
+		if len(anchors) == 0 {
+			differ.myers(a, b, myersCostLimit(len(a)+len(b)))
+		} else {
+			prevA, prevB := 0, 0
+			for _, anchor := range anchors {
+				differ.patience(a[prevA:anchor[0]], b[prevB:anchor[1]])
+				differ.add(diffmatchpatch.DiffEqual, a[anchor[0]:anchor[0]+1])
+				prevA, prevB = anchor[0]+1, anchor[1]+1
+			}
+			differ.patience(a[prevA:], b[prevB:])
+		}
+	}
+	differ.add(diffmatchpatch.DiffEqual, suffix)
+}
+
+// patienceAnchors returns the positions of the unique common lines that
+// form the longest increasing sequence in both a and b.
+func patienceAnchors(a []rune, b []rune) [][2]int {
+	type occurrence struct {
+		countA, countB int
+		posA, posB     int
+	}
+	seen := make(map[rune]*occurrence)
+	for i, line := range a {
+		o, ok := seen[line]
+		if !ok {
+			o = &occurrence{}
+			seen[line] = o
+		}
+		o.countA++
+		o.posA = i
+	}
+	for i, line := range b {
+		if o, ok := seen[line]; ok {
+			o.countB++
+			o.posB = i
+		}
+	}
+
+	unique := [][2]int{}
+	for _, o := range seen {
+		if o.countA == 1 && o.countB == 1 {
+			unique = append(unique, [2]int{o.posA, o.posB})
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i][0] < unique[j][0] })
+
+	// Patience sorting to find the longest increasing sequence of positions in b.
+	tails := []int{}
+	previous := make([]int, len(unique))
+	for i, pair := range unique {
+		pile := sort.Search(len(tails), func(j int) bool { return unique[tails[j]][1] >= pair[1] })
+		previous[i] = -1
+		if pile > 0 {
+			previous[i] = tails[pile-1]
+		}
+		if pile == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[pile] = i
+		}
+	}
+
+	if len(tails) == 0 {
+		return nil
+	}
+	anchors := make([][2]int, len(tails))
+	for i, j := len(tails)-1, tails[len(tails)-1]; i >= 0; i, j = i-1, previous[j] {
+		anchors[i] = unique[j]
+	}
+	return anchors
+}
+
+// histogram splits the diff on the longest common region built around the
+// line that occurs the least often in a, then recurses on both sides.
+// Ranges where every common line repeats too often fall back to myers.
+func (differ *lineDiffer) histogram(a []rune, b []rune) {
+	a, b, suffix := differ.trim(a, b)
+	if !differ.changed(a, b) {
+		startA, endA, startB, endB := histogramRegion(a, b)
+		if endA == startA {
+			differ.myers(a, b, myersCostLimit(len(a)+len(b)))
+		} else {
+			differ.histogram(a[:startA], b[:startB])
+			differ.add(diffmatchpatch.DiffEqual, a[startA:endA])
+			differ.histogram(a[endA:], b[endB:])
+		}
+	}
+	differ.add(diffmatchpatch.DiffEqual, suffix)
+}
+
+// histogramRegion finds the common region with the lowest occurrence count,
+// preferring longer regions when the counts are the same.
+func histogramRegion(a []rune, b []rune) (int, int, int, int) {
+	positions := make(map[rune][]int)
+	for i, line := range a {
+		positions[line] = append(positions[line], i)
+	}
+
+	bestStartA, bestEndA, bestStartB, bestEndB := 0, 0, 0, 0
+	bestCount := histogramMaxChain + 1
+
+	for indexB := 0; indexB < len(b); {
+		candidates := positions[b[indexB]]
+		if len(candidates) == 0 || len(candidates) > bestCount {
+			indexB++
+			continue
+		}
+
+		nextB := indexB + 1
+		for _, indexA := range candidates {
+			startA, startB := indexA, indexB
+			for startA > 0 && startB > 0 && a[startA-1] == b[startB-1] {
+				startA--
+				startB--
+			}
+			endA, endB := indexA+1, indexB+1
+			for endA < len(a) && endB < len(b) && a[endA] == b[endB] {
+				endA++
+				endB++
+			}
+
+			count := len(candidates)
+			for _, line := range a[startA:endA] {
+				if c := len(positions[line]); c < count {
+					count = c
+				}
+			}
+
+			if count < bestCount || (count == bestCount && endA-startA > bestEndA-bestStartA) {
+				bestStartA, bestEndA, bestStartB, bestEndB = startA, endA, startB, endB
+				bestCount = count
+			}
+			if endB > nextB {
+				nextB = endB
+			}
+		}
+		indexB = nextB
+	}
+
+	return bestStartA, bestEndA, bestStartB, bestEndB
+}
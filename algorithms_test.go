@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func Test_validDiffAlgorithm(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"myers", true},
+		{"minimal", true},
+		{"patience", true},
+		{"histogram", true},
+		{"", false},
+		{"Myers", false},
+		{"bogus", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validDiffAlgorithm(tt.name); got != tt.want {
+				t.Errorf("validDiffAlgorithm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diffRunes(t *testing.T) {
+	dmp := diffmatchpatch.New()
+	random := rand.New(rand.NewSource(1))
+
+	randomText := func(size int) string {
+		lines := make([]string, size)
+		for i := range lines {
+			lines[i] = string(rune('a'+random.Intn(6))) + "\n"
+		}
+		return strings.Join(lines, "")
+	}
+
+	inputs := [][2]string{
+		{"", ""},
+		{"a\n", ""},
+		{"", "a\n"},
+		{"a\nb\nc\n", "a\nb\nc\n"},
+		{"a\nb\nc\n", "x\ny\nz\n"},
+		{"a\nb\nc\nd\n", "a\nc\nd\ne\n"},
+		{"{\n}\n\nfoo\n{\n}\n", "{\n}\n\nbar\n{\n}\n\nfoo\n{\n}\n"},
+	}
+	for i := 0; i < 50; i++ {
+		inputs = append(inputs, [2]string{randomText(random.Intn(40)), randomText(random.Intn(40))})
+	}
+
+	for _, algorithm := range diffAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			for _, input := range inputs {
+				keyRunes := make(map[string]rune)
+				a := linesToRunes(splitLinesKeepEnds(input[0]), keyRunes)
+				b := linesToRunes(splitLinesKeepEnds(input[1]), keyRunes)
+				diffs := diffRunes(dmp, algorithm, a, b)
+				if got := dmp.DiffText1(diffs); got != string(a) {
+					t.Errorf("diffRunes() text1 = %q, want %q", got, string(a))
+				}
+				if got := dmp.DiffText2(diffs); got != string(b) {
+					t.Errorf("diffRunes() text2 = %q, want %q", got, string(b))
+				}
+			}
+		})
+	}
+}
+
+func Test_diffRunesMinimal(t *testing.T) {
+	dmp := diffmatchpatch.New()
+	keyRunes := make(map[string]rune)
+	a := linesToRunes(splitLinesKeepEnds("a\nb\nc\na\nb\nb\na\n"), keyRunes)
+	b := linesToRunes(splitLinesKeepEnds("c\nb\na\nb\na\nc\n"), keyRunes)
+
+	// Myers' paper example has an edit distance of 5
+	diffs := diffRunes(dmp, "minimal", a, b)
+	edits := 0
+	for _, diff := range diffs {
+		if diff.Type != diffmatchpatch.DiffEqual {
+			edits += len([]rune(diff.Text))
+		}
+	}
+	if edits != 5 {
+		t.Errorf("diffRunes() minimal edits = %v, want 5", edits)
+	}
+}
+
+func Test_diffLineModePatience(t *testing.T) {
+	defer func() { diffAlgorithm = "myers" }()
+
+	dmp := diffmatchpatch.New()
+	textA := "func a() {\n}\n\nfunc b() {\n}\n"
+	textB := "func a() {\n}\n\nfunc c() {\n}\n\nfunc b() {\n}\n"
+
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{"patience", "func c() {\n}\n\n"},
+		{"histogram", "func c() {\n}\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			diffAlgorithm = tt.algorithm
+			diffs := diffLineMode(dmp, textA, textB)
+			inserted := ""
+			for _, diff := range diffs {
+				if diff.Type == diffmatchpatch.DiffInsert {
+					inserted += diff.Text
+				}
+			}
+			if inserted != tt.want {
+				t.Errorf("diffLineMode() inserted = %q, want %q", inserted, tt.want)
+			}
+		})
+	}
+}
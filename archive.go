@@ -0,0 +1,211 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// archiveSuffixes are the file names read as a directory instead of a file.
+var archiveSuffixes = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+// archiveEntry is a regular file or directory found in an archive.
+type archiveEntry struct {
+	name    string
+	dir     bool
+	content []byte
+}
+
+// isArchive reports if a file name looks like a supported archive.
+func isArchive(fileName string) bool {
+	lowerName := strings.ToLower(fileName)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(lowerName, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// openArchive reads an archive argument as a directory when the other
+// argument is a directory, otherwise it is compared as a file.
+func openArchive(fileX fileInfoExtended, other fileInfoExtended) fileInfoExtended {
+	if fileX.gitObject != "" || fileX.memContent != nil || fileX.fileInfo.IsDir() || !other.fileInfo.IsDir() {
+		return fileX
+	}
+	if !isArchive(fileX.osPathname) {
+		return fileX
+	}
+	return statArchive(fileX.osPathname, fileX.fileInfo)
+}
+
+// statArchive returns the root of an archive, it is read only.
+func statArchive(fileName string, fileInfo os.FileInfo) fileInfoExtended {
+	return fileInfoExtended{
+		osPathname: fileName,
+		fileInfo:   virtualFileInfo{name: fileInfo.Name(), size: fileInfo.Size(), dir: true},
+		archive:    fileName,
+		readOnly:   true,
+	}
+}
+
+// cleanEntryName returns an archive entry name relative to the archive
+// root, the root itself and entries that point outside of the archive
+// return an empty name.
+func cleanEntryName(name string) string {
+	name = path.Clean(strings.TrimLeft(strings.ReplaceAll(name, "\\", "/"), "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return ""
+	}
+	return name
+}
+
+// readTar returns the entries of a tar archive, compressed with gzip when gzipped is set.
+func readTar(reader io.Reader, gzipped bool) ([]archiveEntry, error) {
+	if gzipped {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	entries := []archiveEntry{}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			entries = append(entries, archiveEntry{name: header.Name, dir: true})
+		case tar.TypeReg, tar.TypeRegA:
+			content, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, archiveEntry{name: header.Name, content: content})
+		default:
+			logDebug("Skipping archive entry:" + header.Name)
+		}
+	}
+}
+
+// readZip returns the entries of a zip archive.
+func readZip(fileName string) ([]archiveEntry, error) {
+	zipReader, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer zipReader.Close()
+
+	entries := []archiveEntry{}
+	for _, zipFile := range zipReader.File {
+		mode := zipFile.Mode()
+		if mode.IsDir() {
+			entries = append(entries, archiveEntry{name: zipFile.Name, dir: true})
+			continue
+		}
+		if !mode.IsRegular() {
+			logDebug("Skipping archive entry:" + zipFile.Name)
+			continue
+		}
+
+		fileReader, err := zipFile.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(fileReader)
+		fileReader.Close()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, archiveEntry{name: zipFile.Name, content: content})
+	}
+	return entries, nil
+}
+
+// readArchive returns the entries of any supported archive.
+func readArchive(fileName string) ([]archiveEntry, error) {
+	lowerName := strings.ToLower(fileName)
+	if strings.HasSuffix(lowerName, ".zip") {
+		return readZip(fileName)
+	}
+
+	archiveFile, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer archiveFile.Close()
+	return readTar(archiveFile, !strings.HasSuffix(lowerName, ".tar"))
+}
+
+// getAllArchiveFiles is getAllFiles for an archive, the files are read
+// into memory so nothing is unpacked to disk. They are sorted the way the
+// directory walk finds them, and an entry repeated in the archive is
+// taken from its last copy, the one extracting it would leave.
+func getAllArchiveFiles(root fileInfoExtended) []fileInfoExtended {
+	foundFiles := []fileInfoExtended{}
+	fmt.Println("Loading files from ", root.osPathname)
+
+	entries, err := readArchive(root.archive)
+	if err != nil {
+		logError("Error reading archive", err)
+		return foundFiles
+	}
+
+	latest := map[string]archiveEntry{}
+	names := []string{}
+	for _, entry := range entries {
+		name := cleanEntryName(entry.name)
+		if name == "" {
+			continue
+		}
+		if _, ok := latest[name]; !ok {
+			names = append(names, name)
+		}
+		latest[name] = entry
+	}
+	// Compared element by element, a/b.tf comes before a.tf like in a walk
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ReplaceAll(names[i], "/", "\x00") < strings.ReplaceAll(names[j], "/", "\x00")
+	})
+
+	for _, name := range names {
+		entry := latest[name]
+		osPathname := root.osPathname + "/" + name
+		logDebug("Checking file:" + osPathname)
+		if skipPath(osPathname) {
+			continue
+		}
+
+		if entry.dir {
+			countStats(func(stats *trackedStats) { stats.DirSearched++ })
+			continue
+		}
+
+		logDebug("Including file:" + osPathname)
+		foundFiles = append(foundFiles, fileInfoExtended{
+			osPathname: osPathname,
+			fileInfo:   virtualFileInfo{name: path.Base(name), size: int64(len(entry.content))},
+			memContent: entry.content,
+			readOnly:   true,
+		})
+		countStats(func(stats *trackedStats) { stats.FilesScanned++ })
+	}
+
+	return foundFiles
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DavidGamba/go-getoptions"
+)
+
+var testArchiveFiles = map[string]string{
+	"envs/dev/main.tf":         "version = \"5.0.6\"\n",
+	"envs/dev/modules/vars.tf": "variable \"a\" {}\n",
+	"envs/dev/.hidden":         "secret\n",
+}
+
+// writeTestTar writes testArchiveFiles to a tar file, gzipped when the name ends in gz.
+func writeTestTar(fileName string) {
+	archiveFile, err := os.Create(fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer archiveFile.Close()
+
+	var writer io.Writer = archiveFile
+	if filepath.Ext(fileName) != ".tar" {
+		gzipWriter := gzip.NewWriter(archiveFile)
+		defer gzipWriter.Close()
+		writer = gzipWriter
+	}
+
+	tarWriter := tar.NewWriter(writer)
+	defer tarWriter.Close()
+	tarWriter.WriteHeader(&tar.Header{Name: "./envs/", Typeflag: tar.TypeDir, Mode: 0755})
+	tarWriter.WriteHeader(&tar.Header{Name: "./envs/dev/link.tf", Typeflag: tar.TypeSymlink, Linkname: "main.tf"})
+	for name, content := range testArchiveFiles {
+		tarWriter.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		tarWriter.Write([]byte(content))
+	}
+}
+
+// writeTestZip writes testArchiveFiles to a zip file.
+func writeTestZip(fileName string) {
+	archiveFile, err := os.Create(fileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer archiveFile.Close()
+
+	zipWriter := zip.NewWriter(archiveFile)
+	defer zipWriter.Close()
+	zipWriter.Create("envs/")
+	for name, content := range testArchiveFiles {
+		fileWriter, _ := zipWriter.Create(name)
+		fileWriter.Write([]byte(content))
+	}
+}
+
+func Test_isArchive(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     bool
+	}{
+		{"Tar", "envs.tar", true},
+		{"TarGz", "envs.tar.gz", true},
+		{"Tgz", "envs.TGZ", true},
+		{"Zip", "envs.zip", true},
+		{"Gz", "main.tf.gz", false},
+		{"Plain", "main.tf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isArchive(tt.fileName); got != tt.want {
+				t.Errorf("isArchive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_openArchive(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "archives")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archiveName := filepath.Join(tmpDir, "envs.tar")
+	writeTestTar(archiveName)
+	otherArchive := filepath.Join(tmpDir, "other.tar")
+	writeTestTar(otherArchive)
+	textFile := writeTestFile(filepath.Join(tmpDir, "notes.txt"), "notes\n").osPathname
+
+	tests := []struct {
+		name    string
+		fileX   string
+		other   string
+		wantDir bool
+	}{
+		{"OtherIsDir", archiveName, tmpDir, true},
+		{"OtherIsFile", archiveName, textFile, false},
+		{"BothArchives", archiveName, otherArchive, false},
+		{"NotAnArchive", textFile, tmpDir, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileX, _ := statArgument(tt.fileX)
+			other, _ := statArgument(tt.other)
+			if got := openArchive(fileX, other); got.fileInfo.IsDir() != tt.wantDir {
+				t.Errorf("openArchive() IsDir = %v, want %v", got.fileInfo.IsDir(), tt.wantDir)
+			}
+		})
+	}
+}
+
+func Test_cleanEntryName(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  string
+	}{
+		{"Plain", "envs/dev/main.tf", "envs/dev/main.tf"},
+		{"Dot", "./envs/dev/main.tf", "envs/dev/main.tf"},
+		{"Absolute", "/envs/dev/main.tf", "envs/dev/main.tf"},
+		{"Parent", "../../etc/passwd", ""},
+		{"Escapes", "envs/../../main.tf", ""},
+		{"Inside", "envs/../main.tf", "main.tf"},
+		{"Dir", "./envs/", "envs"},
+		{"Root", "./", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanEntryName(tt.entry); got != tt.want {
+				t.Errorf("cleanEntryName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getAllArchiveFiles(t *testing.T) {
+	defer func() { includeHidden = false }()
+
+	tmpDir, err := ioutil.TempDir("", "archives")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeTestTar(filepath.Join(tmpDir, "envs.tar"))
+	writeTestTar(filepath.Join(tmpDir, "envs.tar.gz"))
+	writeTestZip(filepath.Join(tmpDir, "envs.zip"))
+
+	tests := []struct {
+		name    string
+		archive string
+		hidden  bool
+		want    []string
+	}{
+		{"Tar", "envs.tar", false, []string{"/envs/dev/main.tf", "/envs/dev/modules/vars.tf"}},
+		{"TarGz", "envs.tar.gz", false, []string{"/envs/dev/main.tf", "/envs/dev/modules/vars.tf"}},
+		{"Zip", "envs.zip", false, []string{"/envs/dev/main.tf", "/envs/dev/modules/vars.tf"}},
+		{"Hidden", "envs.zip", true, []string{"/envs/dev/.hidden", "/envs/dev/main.tf", "/envs/dev/modules/vars.tf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			includeHidden = tt.hidden
+			root, err := statArgument(filepath.Join(tmpDir, tt.archive))
+			if err != nil {
+				t.Fatalf("statArgument() error = %v", err)
+			}
+			root = openArchive(root, loadTestFile(tmpDir))
+			if !root.fileInfo.IsDir() || !root.readOnly {
+				t.Errorf("openArchive() IsDir = %v, readOnly = %v, want true", root.fileInfo.IsDir(), root.readOnly)
+			}
+
+			got := []string{}
+			for _, fileExtInfo := range getAllArchiveFiles(root) {
+				key := fileKeyOf(fileExtInfo.osPathname, root.osPathname)
+				got = append(got, key)
+				if content, _ := readFileContent(fileExtInfo); string(content) != testArchiveFiles[key[1:]] {
+					t.Errorf("readFileContent(%v) = %q, want %q", key, content, testArchiveFiles[key[1:]])
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("getAllArchiveFiles() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("getAllArchiveFiles() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_compareFilesArchive(t *testing.T) {
+	defer func() { prompts = nil }()
+
+	tmpDir, err := ioutil.TempDir("", "archives")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archiveName := filepath.Join(tmpDir, "envs.tar.gz")
+	writeTestTar(archiveName)
+	original := writeTestFile(filepath.Join(tmpDir, "envs/dev/main.tf"), "version = \"5.0.8\"\n")
+
+	root, _ := statArgument(archiveName)
+	root = openArchive(root, loadTestFile(tmpDir))
+	var desired fileInfoExtended
+	for _, fileExtInfo := range getAllArchiveFiles(root) {
+		if fileKeyOf(fileExtInfo.osPathname, root.osPathname) == "/envs/dev/main.tf" {
+			desired = fileExtInfo
+		}
+	}
+
+	// The original is patched from the archive
+	setAnswers("y\ny\n")
+	equal, err := compareFiles(original, desired, false, false)
+	if err != nil || equal {
+		t.Errorf("compareFiles() = %v, %v, want false", equal, err)
+	}
+	content, _ := ioutil.ReadFile(original.osPathname)
+	if string(content) != testArchiveFiles["envs/dev/main.tf"] {
+		t.Errorf("compareFiles() = %q, want %q", content, testArchiveFiles["envs/dev/main.tf"])
+	}
+}
+
+func Test_getAllArchiveFilesTopLevelDirectory(t *testing.T) {
+	defer func() { pathMappings = nil }()
+	defer func() { prompts = nil }()
+	prompts = fixedPrompter{answer: "n"}
+
+	tmpDir, err := ioutil.TempDir("", "archives")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// A release tarball, with the files below project-1.2/ and main.tf added twice
+	archiveName := filepath.Join(tmpDir, "project-1.2.tar")
+	archiveFile, err := os.Create(archiveName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tarWriter := tar.NewWriter(archiveFile)
+	for _, entry := range [][2]string{
+		{"project-1.2/main.tf", "old\n"},
+		{"project-1.2/modules/vars.tf", "variable \"a\" {}\n"},
+		{"project-1.2/README", "readme\n"},
+		{"project-1.2/main.tf", "version = \"5.0.8\"\n"},
+	} {
+		tarWriter.WriteHeader(&tar.Header{Name: entry[0], Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(entry[1]))})
+		tarWriter.Write([]byte(entry[1]))
+	}
+	tarWriter.Close()
+	archiveFile.Close()
+
+	checkout := filepath.Join(tmpDir, "checkout")
+	writeTestFile(filepath.Join(checkout, "main.tf"), "version = \"5.0.6\"\n")
+	writeTestFile(filepath.Join(checkout, "modules/vars.tf"), "variable \"a\" {}\n")
+	writeTestFile(filepath.Join(checkout, "README"), "readme\n")
+
+	root, _ := statArgument(archiveName)
+	root = openArchive(root, loadTestFile(checkout))
+	got := []string{}
+	for _, fileExtInfo := range getAllArchiveFiles(root) {
+		got = append(got, fileKeyOf(fileExtInfo.osPathname, root.osPathname))
+	}
+	want := []string{"/project-1.2/README", "/project-1.2/main.tf", "/project-1.2/modules/vars.tf"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("getAllArchiveFiles() = %v, want %v", got, want)
+	}
+
+	// Paired with the checkout, only the last copy of main.tf differs
+	optTest := getoptions.New()
+	optTest.Bool("report-only", true)
+	pathMappings, _ = parsePathMappings([]string{"project-1.2=."})
+	checkoutExt, _ := statArgument(checkout)
+	before := runtimeStats.FilesWDiff
+	if got := mainWork(optTest, checkoutExt, root); got != 0 {
+		t.Errorf("mainWork() = %v, want 0", got)
+	}
+	if got := runtimeStats.FilesWDiff - before; got != 1 {
+		t.Errorf("mainWork() diffs = %v, want 1", got)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// digestCacheVersion changes whenever the format of the cache does.
+const digestCacheVersion = 1
+
+// A digest is only cached for a file unchanged this long before it is read,
+// a file written again within the same mtime tick would keep its key.
+const digestRacyWindow = 2 * time.Second
+
+// Digests of files not compared for this long are dropped from the cache,
+// when a digest was used is only updated once a day so the cache of an
+// unchanged tree is not written again on every run.
+const digestCacheExpiry = 30 * 24 * time.Hour
+const digestUsedPrecision = 24 * 60 * 60
+
+// digestEntry is the digest of a file, valid while its key is unchanged.
+type digestEntry struct {
+	Size   int64  `json:"size"`
+	Mtime  int64  `json:"mtime"`
+	Inode  uint64 `json:"inode"`
+	SHA256 string `json:"sha256"`
+	Used   int64  `json:"used"`
+}
+
+// digestCache keeps the content digests of files on disk between runs, so
+// files unchanged since the last run are compared without reading them.
+type digestCache struct {
+	Version int                    `json:"version"`
+	Files   map[string]digestEntry `json:"files"`
+	path    string
+	dirty   bool
+	lock    sync.Mutex
+}
+
+// digests is nil with --no-cache.
+var digests *digestCache
+
+// defaultDigestCacheFile returns where the cache is kept, in the user cache directory.
+func defaultDigestCacheFile() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		logDebug("No cache directory: " + err.Error())
+		return ""
+	}
+	return filepath.Join(cacheDir, "dap", "digests.json")
+}
+
+// loadDigestCache reads the cache, a missing or outdated cache starts empty.
+// Digests are of the raw content, they hold whatever the comparison options.
+func loadDigestCache(path string) *digestCache {
+	cache := &digestCache{Version: digestCacheVersion, Files: map[string]digestEntry{}, path: path}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+
+	loaded := &digestCache{}
+	if err := json.Unmarshal(content, loaded); err != nil || loaded.Version != digestCacheVersion {
+		logDebug("Digest cache is out of date, starting over: " + path)
+		cache.dirty = true
+		return cache
+	}
+	if loaded.Files != nil {
+		cache.Files = loaded.Files
+	}
+	return cache
+}
+
+// save writes the cache when it changed, digests not used for a while are dropped.
+func (c *digestCache) save() error {
+	if !c.dirty || c.path == "" {
+		return nil
+	}
+	expired := time.Now().Add(-digestCacheExpiry).Unix()
+	for key, entry := range c.Files {
+		if entry.Used < expired {
+			delete(c.Files, key)
+		}
+	}
+
+	content, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	// Written next to the cache and renamed, so other runs never read half of it
+	tmpFile, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), c.path)
+}
+
+// digest returns the digest of a file on disk, from the cache while its
+// path, size, mtime and inode are unchanged.
+func (c *digestCache) digest(osPathname string, info os.FileInfo) (string, error) {
+	key, err := filepath.Abs(osPathname)
+	if err != nil {
+		return "", err
+	}
+	entry := digestEntry{Size: info.Size(), Mtime: info.ModTime().UnixNano(), Inode: fileInode(info), Used: time.Now().Unix()}
+
+	c.lock.Lock()
+	cached, ok := c.Files[key]
+	if ok && cached.Size == entry.Size && cached.Mtime == entry.Mtime && cached.Inode == entry.Inode {
+		if entry.Used-cached.Used > digestUsedPrecision {
+			cached.Used = entry.Used
+			c.Files[key] = cached
+			c.dirty = true
+		}
+		c.lock.Unlock()
+		return cached.SHA256, nil
+	}
+	c.lock.Unlock()
+
+	file, err := os.Open(osPathname)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if time.Since(info.ModTime()) > digestRacyWindow {
+		c.lock.Lock()
+		c.Files[key] = entry
+		c.dirty = true
+		c.lock.Unlock()
+	}
+	return entry.SHA256, nil
+}
+
+// equal compares two files on disk by their digests.
+func (c *digestCache) equal(osPathnameA string, osPathnameB string) (bool, error) {
+	infoA, err := os.Stat(osPathnameA)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(osPathnameB)
+	if err != nil {
+		return false, err
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+
+	digestA, err := c.digest(osPathnameA, infoA)
+	if err != nil {
+		return false, err
+	}
+	digestB, err := c.digest(osPathnameB, infoB)
+	if err != nil {
+		return false, err
+	}
+	return digestA == digestB, nil
+}
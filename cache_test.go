@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeOldTestFile writes a file last modified an hour ago, outside the racy window.
+func writeOldTestFile(fileName string, content string) string {
+	writeTestFile(fileName, content)
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(fileName, old, old); err != nil {
+		log.Fatal(err)
+	}
+	return fileName
+}
+
+func Test_digestCacheEqual(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "digests")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cacheFile := filepath.Join(tmpDir, "cache/digests.json")
+	fileA := writeOldTestFile(filepath.Join(tmpDir, "a/t1.txt"), "same\n")
+	fileB := writeOldTestFile(filepath.Join(tmpDir, "b/t1.txt"), "same\n")
+	fileC := writeOldTestFile(filepath.Join(tmpDir, "b/t2.txt"), "diff\n")
+	fresh := writeTestFile(filepath.Join(tmpDir, "b/t3.txt"), "same\n").osPathname
+
+	cache := loadDigestCache(cacheFile)
+	tests := []struct {
+		name  string
+		fileA string
+		fileB string
+		want  bool
+	}{
+		{"Same", fileA, fileB, true},
+		{"SameSize", fileA, fileC, false},
+		{"Fresh", fileA, fresh, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := cache.equal(tt.fileA, tt.fileB); err != nil || got != tt.want {
+				t.Errorf("equal() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+	if len(cache.Files) != 3 {
+		t.Errorf("equal() cached %v files, want 3, recently modified files are not cached", len(cache.Files))
+	}
+	if err := cache.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	// A changed file is read again, its size, mtime or inode differ
+	writeOldTestFile(fileB, "changed\n")
+	reloaded := loadDigestCache(cacheFile)
+	if len(reloaded.Files) != 3 {
+		t.Fatalf("loadDigestCache() = %v files, want 3", len(reloaded.Files))
+	}
+	if got, _ := reloaded.equal(fileA, fileB); got {
+		t.Errorf("equal() = true for a changed file")
+	}
+
+	// Only the digest from the cache is used for an unchanged file
+	key, _ := filepath.Abs(fileA)
+	entry := reloaded.Files[key]
+	entry.SHA256 = "cached"
+	reloaded.Files[key] = entry
+	info, _ := os.Stat(fileA)
+	if got, _ := reloaded.digest(fileA, info); got != "cached" {
+		t.Errorf("digest() = %v, want the cached digest", got)
+	}
+}
+
+func Test_loadDigestCache(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "digests")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cacheFile := filepath.Join(tmpDir, "digests.json")
+	fileA := writeOldTestFile(filepath.Join(tmpDir, "a/t1.txt"), "same\n")
+	cache := loadDigestCache(cacheFile)
+	info, _ := os.Stat(fileA)
+	cache.digest(fileA, info)
+	if err := cache.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{"Same", "", 1},
+		{"WithOptions", `{"version": 1, "options": "b=true", "files": {"/t1.txt": {}}}`, 1},
+		{"OtherVersion", `{"version": 0, "files": {"/t1.txt": {}}}`, 0},
+		{"Invalid", "{", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.content != "" {
+				writeTestFile(cacheFile, tt.content)
+			}
+			if got := loadDigestCache(cacheFile); len(got.Files) != tt.want {
+				t.Errorf("loadDigestCache() = %v files, want %v", len(got.Files), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// fileInode returns 0, Windows has no inode in the result of os.Stat.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
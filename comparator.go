@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Comparator compares and patches one type of file.
+type Comparator interface {
+	Name() string
+	// Detect reports if the comparator handles a file, head is the start of its content
+	Detect(fileName string, head []byte) bool
+	// Diff returns the changes to review, false hands the files on to the next comparator
+	Diff(textA string, textB string) ([]structChange, bool)
+	// Apply writes the selected changes into the text of <original>
+	Apply(textA string, selected []structChange) (string, error)
+}
+
+// reviewer is a Comparator with its own review of the changes it found,
+// the others are reviewed change by change.
+type reviewer interface {
+	Review(fileAExt fileInfoExtended, fileBExt fileInfoExtended, changes []structChange) (fileDiffInfo, error)
+}
+
+// recorder is a Comparator that keeps the changes accepted for each file.
+type recorder interface {
+	Record(fileName string, accepted []structChange)
+}
+
+// comparators are keyed by globs on the file name and tried in order, the
+// first one to detect both files and diff them is used. Files none of them
+// takes go to defaultComparator.
+var comparators = []Comparator{
+	&structFormat{name: "YAML", globs: yamlGlobs, diff: diffYAML},
+	&structFormat{name: "JSON", globs: jsonGlobs, diff: diffJSON, finish: tidyJSONCommas, record: recordJSONPatch},
+	&structFormat{name: "HCL", globs: hclGlobs, diff: diffHCL},
+	&structFormat{name: "dotenv", globs: dotenvGlobs, diff: diffKeyValues(dotenvSyntax)},
+	&structFormat{name: "properties", globs: propertiesGlobs, diff: diffKeyValues(propertiesSyntax)},
+	&structFormat{name: "INI", globs: iniGlobs, diff: diffINI},
+}
+
+// defaultComparator takes every file, it compares them line by line.
+var defaultComparator Comparator = lineComparator{}
+
+// externalComparators come from --comparator and are tried before the others.
+var externalComparators []Comparator
+
+// contentHead returns the start of a file, enough to sniff its MIME type.
+func contentHead(content []byte) []byte {
+	if len(content) > 512 {
+		return content[:512]
+	}
+	return content
+}
+
+// matchGlobs reports if the base name of a file, in lower case, matches one of globs.
+func matchGlobs(globs []string, fileName string) bool {
+	base := strings.ToLower(filepath.Base(fileName))
+	for _, glob := range globs {
+		if match, _ := path.Match(glob, base); match {
+			return true
+		}
+	}
+	return false
+}
+
+// lineOptionsActive reports if an option only the line diff knows about is
+// set, the built-in comparators are not used then.
+func lineOptionsActive() bool {
+	return lineCompareActive() || wordDiff != "none" || diffAlgorithm != "myers"
+}
+
+// lineOnlyOption returns the option that keeps the built-in comparators
+// from being used, empty when there is none.
+func lineOnlyOption() string {
+	switch {
+	case promotedHunks != nil:
+		return "--into"
+	case writeBoth:
+		return "--write-both"
+	case ignoreSpaceChange:
+		return "--ignore-space-change"
+	case ignoreAllSpace:
+		return "--ignore-all-space"
+	case ignoreBlankLines:
+		return "--ignore-blank-lines"
+	case ignoreCase:
+		return "--ignore-case"
+	case len(ignoreLineRegexps) > 0:
+		return "--ignore-matching-lines"
+	case wordDiff != "none":
+		return "--word-diff"
+	case diffAlgorithm != "myers":
+		return "--diff-algorithm"
+	}
+	return ""
+}
+
+// fallbackNotices holds the built-in comparators a notice was printed for
+// in this run, when their files were compared line by line because of an option.
+var fallbackNotices map[string]bool
+
+// noticeFallback prints once per run and type of file that files a
+// built-in comparator takes are compared line by line instead.
+func noticeFallback(comparator Comparator, fileAExt fileInfoExtended, fileBExt fileInfoExtended) {
+	option := lineOnlyOption()
+	if comparator != defaultComparator || option == "" {
+		return
+	}
+	for _, builtin := range comparators {
+		if !builtin.Detect(fileAExt.osPathname, nil) || !builtin.Detect(fileBExt.osPathname, nil) || fallbackNotices[builtin.Name()] {
+			continue
+		}
+		if fallbackNotices == nil {
+			fallbackNotices = map[string]bool{}
+		}
+		fallbackNotices[builtin.Name()] = true
+		fmt.Printf("Notice: %s files are compared line by line with %s\n", builtin.Name(), option)
+	}
+}
+
+// findComparator returns the comparator for two files and the changes it
+// found between them, changes ignored by --ignore-key are left out.
+func findComparator(fileAExt fileInfoExtended, fileBExt fileInfoExtended) (Comparator, []structChange) {
+	candidates := []Comparator{}
+	// Both files are only rebuilt from line hunks, and only line hunks are promoted
+	if !writeBoth && promotedHunks == nil {
+		candidates = append(candidates, externalComparators...)
+		if !lineOptionsActive() {
+			candidates = append(candidates, comparators...)
+		}
+	}
+
+	headA, headB := contentHead(fileAExt.fileContent), contentHead(fileBExt.fileContent)
+	for _, comparator := range candidates {
+		if !comparator.Detect(fileAExt.osPathname, headA) || !comparator.Detect(fileBExt.osPathname, headB) {
+			continue
+		}
+		changes, ok := comparator.Diff(fileAExt.fileContentString, fileBExt.fileContentString)
+		if !ok {
+			continue
+		}
+		logDebug("Comparing with: " + comparator.Name())
+
+		kept := []structChange{}
+		for _, change := range changes {
+			if ignoredKey(change.path) {
+				logDebug("Ignoring change to: " + change.path)
+				continue
+			}
+			kept = append(kept, change)
+		}
+		return comparator, kept
+	}
+
+	changes, _ := defaultComparator.Diff(fileAExt.fileContentString, fileBExt.fileContentString)
+	return defaultComparator, changes
+}
+
+// lineDiff is the hunk behind a change found by the line comparator, with
+// the diff of the whole file it is part of.
+type lineDiff struct {
+	hunk  diffHunk
+	diffs []diffmatchpatch.Diff
+}
+
+// lineComparator is the default comparator, it diffs files line by line.
+// Its changes are the hunks, reviewed with the merge answers.
+type lineComparator struct{}
+
+func (lineComparator) Name() string {
+	return "lines"
+}
+
+func (lineComparator) Detect(fileName string, head []byte) bool {
+	return true
+}
+
+// Diff returns a change for every hunk, replacing its lines of the original.
+func (lineComparator) Diff(textA string, textB string) ([]structChange, bool) {
+	dmp := diffmatchpatch.New()
+	diffs := diffLineMode(dmp, textA, textB)
+
+	lineStarts := []int{0}
+	for _, line := range splitLinesKeepEnds(textA) {
+		lineStarts = append(lineStarts, lineStarts[len(lineStarts)-1]+len(line))
+	}
+
+	changes := []structChange{}
+	for _, hunk := range groupHunks(diffs, diffContext) {
+		before, after := resolveHunk(hunk, resolveDesired)
+		start := lineStarts[hunk.startA]
+		changes = append(changes, structChange{
+			kind:   keyChanged,
+			path:   "@@ -" + hunkRange(hunk.startA, hunk.linesA) + " +" + hunkRange(hunk.startB, hunk.linesB) + " @@",
+			before: strings.TrimSuffix(before, "\n"),
+			after:  strings.TrimSuffix(after, "\n"),
+			start:  start,
+			end:    start + len(before),
+			text:   after,
+			line:   &lineDiff{hunk: hunk, diffs: diffs},
+		})
+	}
+	return changes, true
+}
+
+// Apply replaces the lines of every selected hunk with its text.
+func (lineComparator) Apply(textA string, selected []structChange) (string, error) {
+	return applyStructChanges(textA, selected), nil
+}
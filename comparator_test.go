@@ -0,0 +1,255 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_findComparator(t *testing.T) {
+	defer func() { writeBoth, externalComparators, ignoreAllSpace, wordDiff = false, nil, false, "none" }()
+
+	tests := []struct {
+		name       string
+		fileName   string
+		content    string
+		writeBoth  bool
+		lineOption bool
+		external   []string
+		want       string
+	}{
+		{"YAML", "values.yaml", "a: 1\n", false, false, nil, "YAML"},
+		{"Text", "notes.txt", "a: 1\n", false, false, nil, "lines"},
+		{"NotINI", "nginx.conf", "server {\n}\n", false, false, nil, "lines"},
+		{"WriteBoth", "values.yaml", "a: 1\n", true, false, nil, "lines"},
+		{"LineOption", "values.yaml", "a: 1\n", false, true, nil, "lines"},
+		{"ExternalFirst", "values.yaml", "a: 1\n", false, false, []string{`*.yaml=echo {"comparable":true}`}, `echo {"comparable":true}`},
+		{"ExternalLineOption", "values.yaml", "a: 1\n", false, true, []string{`*.yaml=echo {"comparable":true}`}, `echo {"comparable":true}`},
+		{"ExternalNotComparable", "values.yaml", "a: 1\n", false, false, []string{`*.yaml=echo {"comparable":false}`}, "YAML"},
+		{"ExternalOther", "notes.txt", "a: 1\n", false, false, []string{`*.yaml=echo {"comparable":true}`}, "lines"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeBoth = tt.writeBoth
+			ignoreAllSpace = tt.lineOption
+			externalComparators, _ = parseComparatorRules(tt.external)
+			fileA := fileInfoExtended{osPathname: "a/" + tt.fileName, fileContent: []byte(tt.content), fileContentString: tt.content}
+			fileB := fileInfoExtended{osPathname: "b/" + tt.fileName, fileContent: []byte("b: 2\n"), fileContentString: "b: 2\n"}
+			if comparator, _ := findComparator(fileA, fileB); comparator.Name() != tt.want {
+				t.Errorf("findComparator() = %v, want %v", comparator.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func Test_noticeFallback(t *testing.T) {
+	defer func() { writeBoth, ignoreCase, fallbackNotices = false, false, nil }()
+
+	tests := []struct {
+		name       string
+		fileName   string
+		writeBoth  bool
+		ignoreCase bool
+		want       bool
+	}{
+		{"Default", "values.yaml", false, false, false},
+		{"WriteBoth", "values.yaml", true, false, true},
+		{"IgnoreCase", "values.yaml", false, true, true},
+		{"Text", "notes.txt", true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeBoth, ignoreCase, fallbackNotices = tt.writeBoth, tt.ignoreCase, nil
+			fileA := fileInfoExtended{osPathname: "a/" + tt.fileName}
+			fileB := fileInfoExtended{osPathname: "b/" + tt.fileName}
+			noticeFallback(defaultComparator, fileA, fileB)
+			if got := len(fallbackNotices) > 0; got != tt.want {
+				t.Errorf("noticeFallback() noticed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lineOptionsActive(t *testing.T) {
+	defer func() { ignoreCase, wordDiff, diffAlgorithm = false, "none", "myers" }()
+
+	tests := []struct {
+		name          string
+		ignoreCase    bool
+		wordDiff      string
+		diffAlgorithm string
+		want          bool
+	}{
+		{"Default", false, "none", "myers", false},
+		{"IgnoreCase", true, "none", "myers", true},
+		{"WordDiff", false, "color", "myers", true},
+		{"Patience", false, "none", "patience", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ignoreCase, wordDiff, diffAlgorithm = tt.ignoreCase, tt.wordDiff, tt.diffAlgorithm
+			if got := lineOptionsActive(); got != tt.want {
+				t.Errorf("lineOptionsActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lineComparatorDiff(t *testing.T) {
+	textA := "a\nb\nc\nd\ne\nf\ng\n"
+	textB := "a\nB\nc\nd\ne\nf\ng\nh\n"
+	changes, ok := lineComparator{}.Diff(textA, textB)
+	if !ok || len(changes) != 2 {
+		t.Fatalf("Diff() = %v, %v, want two hunks", changes, ok)
+	}
+	if changes[0].path != "@@ -1,3 +1,3 @@" {
+		t.Errorf("Diff() path = %v, want @@ -1,3 +1,3 @@", changes[0].path)
+	}
+	if got, _ := (lineComparator{}).Apply(textA, changes); got != textB {
+		t.Errorf("Apply() = %q, want %q", got, textB)
+	}
+	if got, _ := (lineComparator{}).Apply(textA, changes[1:]); got != "a\nb\nc\nd\ne\nf\ng\nh\n" {
+		t.Errorf("Apply() second hunk = %q", got)
+	}
+}
+
+func Test_compareFilesLineResolution(t *testing.T) {
+	defer func() { prompts = nil }()
+
+	tmpDir, err := ioutil.TempDir("", "lines")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name    string
+		answers string
+		want    string
+	}{
+		{"Desired", "y\ny\ny\n", "a\nB\nc\nd\ne\nf\ng\nh\n"},
+		{"SecondOnly", "y\nn\ny\n", "a\nb\nc\nd\ne\nf\ng\nh\n"},
+		{"OriginalThenDesired", "y\na\nn\n", "a\nb\nB\nc\nd\ne\nf\ng\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := writeTestFile(filepath.Join(tmpDir, tt.name, "a/notes.txt"), "a\nb\nc\nd\ne\nf\ng\n")
+			desired := writeTestFile(filepath.Join(tmpDir, tt.name, "b/notes.txt"), "a\nB\nc\nd\ne\nf\ng\nh\n")
+			setAnswers(tt.answers)
+			if _, err := compareFiles(original, desired, false, false); err != nil {
+				t.Fatalf("compareFiles() error = %v", err)
+			}
+			content, _ := ioutil.ReadFile(original.osPathname)
+			if string(content) != tt.want {
+				t.Errorf("compareFiles() = %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseComparatorRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		wantErr bool
+	}{
+		{"Glob", []string{"*.xml=xmldiff --json"}, false},
+		{"Mime", []string{"image/*=imgdiff"}, false},
+		{"NoCommand", []string{"*.xml="}, true},
+		{"NoPattern", []string{"=xmldiff"}, true},
+		{"BadGlob", []string{"[.xml=xmldiff"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseComparatorRules(tt.rules); (err != nil) != tt.wantErr {
+				t.Errorf("parseComparatorRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_externalComparatorDetect(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		name     string
+		pattern  string
+		fileName string
+		head     []byte
+		want     bool
+	}{
+		{"Glob", "*.xml", "dir/pom.xml", []byte("<project/>"), true},
+		{"GlobOther", "*.xml", "dir/pom.txt", []byte("<project/>"), false},
+		{"Mime", "image/*", "logo.bin", png, true},
+		{"MimeText", "image/*", "logo.png", []byte("not an image"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &externalComparator{pattern: tt.pattern, command: []string{"true"}}
+			if got := c.Detect(tt.fileName, tt.head); got != tt.want {
+				t.Errorf("Detect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_externalComparatorDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantOk   bool
+		wantLen  int
+	}{
+		{"Changed", `{"comparable":true,"changes":[{"kind":"changed","path":"a","before":"1","after":"2"}]}`, true, 1},
+		{"NoChanges", `{"comparable":true,"changes":[]}`, true, 0},
+		{"NotComparable", `{"comparable":false}`, false, 0},
+		{"UnknownKind", `{"comparable":true,"changes":[{"kind":"renamed","path":"a"}]}`, false, 0},
+		{"MissingKind", `{"comparable":true,"changes":[{"path":"a"}]}`, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &externalComparator{pattern: "*", command: []string{"echo", tt.response}}
+			changes, ok := c.Diff("a\n", "b\n")
+			if ok != tt.wantOk || len(changes) != tt.wantLen {
+				t.Errorf("Diff() = %v, %v, want %v changes, %v", changes, ok, tt.wantLen, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_compareFilesExternal(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer func() { externalComparators = nil }()
+
+	tmpDir, err := ioutil.TempDir("", "external")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Answers with one change, and applies it only when it comes back with its id
+	script := writeTestFile(filepath.Join(tmpDir, "compare.sh"), `#!/bin/sh
+input=$(cat)
+case "$input" in
+*'"action":"apply"'*'"id":7'*) printf '%s\n' '{"content": "patched\n"}' ;;
+*'"action":"apply"'*) exit 1 ;;
+*) printf '%s\n' '{"comparable": true, "changes": [{"kind": "changed", "path": "pixels", "before": "a", "after": "b", "id": 7}]}' ;;
+esac
+`)
+	os.Chmod(script.osPathname, 0755)
+	externalComparators, _ = parseComparatorRules([]string{"*.img=" + script.osPathname})
+
+	original := writeTestFile(filepath.Join(tmpDir, "a/logo.img"), "a\n")
+	desired := writeTestFile(filepath.Join(tmpDir, "b/logo.img"), "b\n")
+
+	setAnswers("y\ny\n")
+	equal, err := compareFiles(original, desired, false, false)
+	if err != nil || equal {
+		t.Errorf("compareFiles() = %v, %v, want false", equal, err)
+	}
+	content, _ := ioutil.ReadFile(original.osPathname)
+	if string(content) != "patched\n" {
+		t.Errorf("compareFiles() = %q, want patched", content)
+	}
+}
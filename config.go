@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configOptions are the repeatable options that can be kept in a config
+// file, for every file compared or under a profile.
+type configOptions struct {
+	IgnoreMatchingLines []string `yaml:"ignore-matching-lines"`
+	Map                 []string `yaml:"map"`
+	Substitute          []string `yaml:"substitute"`
+}
+
+// dapConfig is the content of a config file, for example:
+//
+//	ignore-matching-lines:
+//	  - '^# Generated'
+//	profiles:
+//	  prod:
+//	    substitute:
+//	      - '-dev-=-prod-'
+type dapConfig struct {
+	configOptions `yaml:",inline"`
+	Profiles      map[string]configOptions `yaml:"profiles"`
+}
+
+// userConfigFile is read when --config is not given, a missing file is no error.
+var userConfigFile string
+
+// defaultUserConfigFile returns the config file in the user config directory.
+func defaultUserConfigFile() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		logDebug("No config directory: " + err.Error())
+		return ""
+	}
+	return filepath.Join(configDir, "dap", "config.yaml")
+}
+
+// parseConfig reads a config file, unknown options are an error.
+func parseConfig(content []byte) (dapConfig, error) {
+	config := dapConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return config, err
+	}
+	return config, nil
+}
+
+// loadConfigOptions returns the options of the config file followed by
+// the ones of the profile. Without --config the user config file is read
+// when there is one.
+func loadConfigOptions(path string, profile string) (configOptions, error) {
+	required := path != ""
+	if !required {
+		path = userConfigFile
+	}
+
+	config := dapConfig{}
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil && (required || !os.IsNotExist(err)) {
+			return configOptions{}, err
+		}
+		if err == nil {
+			logDebug("Reading config: " + path)
+			if config, err = parseConfig(content); err != nil {
+				return configOptions{}, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	options := config.configOptions
+	if profile != "" {
+		profileOptions, ok := config.Profiles[profile]
+		if !ok {
+			return configOptions{}, fmt.Errorf("no profile %s in the config", profile)
+		}
+		options.IgnoreMatchingLines = append(options.IgnoreMatchingLines, profileOptions.IgnoreMatchingLines...)
+		options.Map = append(options.Map, profileOptions.Map...)
+		options.Substitute = append(options.Substitute, profileOptions.Substitute...)
+	}
+	return options, nil
+}
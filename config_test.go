@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_loadConfigOptions(t *testing.T) {
+	defer func(file string) { userConfigFile = file }(userConfigFile)
+
+	tmpDir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configPath := writeTestFile(filepath.Join(tmpDir, "dap.yaml"), `ignore-matching-lines:
+  - '^# Generated'
+map:
+  - modules=modules-v2
+profiles:
+  prod:
+    ignore-matching-lines:
+      - '^\s*tags'
+    substitute:
+      - -dev-=-prod-
+`).osPathname
+	badPath := writeTestFile(filepath.Join(tmpDir, "bad.yaml"), "substitutes:\n  - a=b\n").osPathname
+	emptyPath := writeTestFile(filepath.Join(tmpDir, "empty.yaml"), "").osPathname
+
+	tests := []struct {
+		name     string
+		path     string
+		userFile string
+		profile  string
+		want     configOptions
+		wantErr  bool
+	}{
+		{"Config", configPath, "", "", configOptions{IgnoreMatchingLines: []string{"^# Generated"}, Map: []string{"modules=modules-v2"}}, false},
+		{"Profile", configPath, "", "prod", configOptions{IgnoreMatchingLines: []string{"^# Generated", `^\s*tags`}, Map: []string{"modules=modules-v2"}, Substitute: []string{"-dev-=-prod-"}}, false},
+		{"UserFile", "", configPath, "", configOptions{IgnoreMatchingLines: []string{"^# Generated"}, Map: []string{"modules=modules-v2"}}, false},
+		{"NoUserFile", "", filepath.Join(tmpDir, "missing.yaml"), "", configOptions{}, false},
+		{"Empty", emptyPath, "", "", configOptions{}, false},
+		{"Missing", filepath.Join(tmpDir, "missing.yaml"), "", "", configOptions{}, true},
+		{"UnknownOption", badPath, "", "", configOptions{}, true},
+		{"UnknownProfile", configPath, "", "qa", configOptions{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userConfigFile = tt.userFile
+			got, err := loadConfigOptions(tt.path, tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfigOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadConfigOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_programConfig(t *testing.T) {
+	defer func() {
+		ignoreMatchingLines, ignoreLineRegexps = nil, nil
+		substituteRules, substitutions = nil, nil
+		pathMapRules, pathMappings = nil, nil
+		digests = nil
+	}()
+
+	tmpDir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configPath := writeTestFile(filepath.Join(tmpDir, "dap.yaml"), "profiles:\n  dev:\n    substitute:\n      - -prod-=-dev-\n").osPathname
+	original := writeTestFile(filepath.Join(tmpDir, "a/main.tf"), "name = \"app-dev-1\"\n")
+	desired := writeTestFile(filepath.Join(tmpDir, "b/main.tf"), "name = \"app-prod-1\"\n")
+
+	// The substitution of the profile makes the files the same, nothing is asked
+	if got := program([]string{"--config", configPath, "--profile", "dev", "--no-cache", original.osPathname, desired.osPathname}); got != 0 {
+		t.Errorf("program() = %v, want 0", got)
+	}
+	if !reflect.DeepEqual(substituteRules, []string{"-prod-=-dev-"}) {
+		t.Errorf("program() substituteRules = %q", substituteRules)
+	}
+}
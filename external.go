@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// externalComparator runs an executable that speaks JSON on stdin and stdout.
+//
+// To diff it is sent {"action": "diff", "original": text, "desired": text}
+// and answers {"comparable": true, "changes": [change, ...]}, comparable
+// false hands the files on to the next comparator. A change is
+// {"kind": "changed" | "added" | "removed", "path", "before", "after"} and
+// may hold any other fields the executable needs to apply it.
+//
+// To apply it is sent {"action": "apply", "original": text, "changes": [...]}
+// with the selected changes as it returned them, and answers {"content": text}.
+type externalComparator struct {
+	pattern string // glob on the file name, or a MIME type when it holds a slash
+	command []string
+}
+
+type externalRequest struct {
+	Action   string            `json:"action"`
+	Original string            `json:"original"`
+	Desired  string            `json:"desired,omitempty"`
+	Changes  []json.RawMessage `json:"changes,omitempty"`
+}
+
+type externalResponse struct {
+	Comparable bool              `json:"comparable"`
+	Changes    []json.RawMessage `json:"changes"`
+	Content    *string           `json:"content"`
+}
+
+type externalChange struct {
+	Kind   string `json:"kind"`
+	Path   string `json:"path"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+var externalKinds = map[string]structChangeKind{"changed": keyChanged, "added": keyAdded, "removed": keyRemoved}
+
+// parseComparatorRules reads --comparator rules written as pattern=command.
+func parseComparatorRules(rules []string) ([]Comparator, error) {
+	parsed := []Comparator{}
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("%s is not pattern=command", rule)
+		}
+		if _, err := path.Match(parts[0], ""); err != nil {
+			return nil, fmt.Errorf("%s: %w", rule, err)
+		}
+		parsed = append(parsed, &externalComparator{pattern: parts[0], command: strings.Fields(parts[1])})
+	}
+	return parsed, nil
+}
+
+func (c *externalComparator) Name() string {
+	return strings.Join(c.command, " ")
+}
+
+// Detect matches the pattern against the base name of the file, or against
+// the MIME type sniffed from its content for patterns such as image/*.
+func (c *externalComparator) Detect(fileName string, head []byte) bool {
+	subject := filepath.Base(fileName)
+	if strings.Contains(c.pattern, "/") {
+		subject = strings.TrimSpace(strings.Split(http.DetectContentType(head), ";")[0])
+	}
+	match, _ := path.Match(c.pattern, subject)
+	return match
+}
+
+// run sends a request to the executable and reads its response.
+func (c *externalComparator) run(request externalRequest) (externalResponse, error) {
+	response := externalResponse{}
+	input, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+
+	cmd := exec.Command(c.command[0], c.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return response, fmt.Errorf("comparator %s: %w", c.Name(), err)
+	}
+	if err := json.Unmarshal(output, &response); err != nil {
+		return response, fmt.Errorf("comparator %s: invalid response: %w", c.Name(), err)
+	}
+	return response, nil
+}
+
+func (c *externalComparator) Diff(textA string, textB string) ([]structChange, bool) {
+	response, err := c.run(externalRequest{Action: "diff", Original: textA, Desired: textB})
+	if err != nil {
+		logError("External comparator failed", err)
+		return nil, false
+	}
+	if !response.Comparable {
+		return nil, false
+	}
+
+	changes := []structChange{}
+	for _, raw := range response.Changes {
+		change := externalChange{}
+		if err := json.Unmarshal(raw, &change); err != nil {
+			logError("External comparator failed", fmt.Errorf("comparator %s: invalid change: %w", c.Name(), err))
+			return nil, false
+		}
+		kind, ok := externalKinds[change.Kind]
+		if !ok {
+			logError("External comparator failed", fmt.Errorf("comparator %s: invalid change kind: %q", c.Name(), change.Kind))
+			return nil, false
+		}
+		// The change is sent back as it came when it is applied
+		changes = append(changes, structChange{kind: kind, path: change.Path, before: change.Before, after: change.After, text: string(raw)})
+	}
+	return changes, true
+}
+
+func (c *externalComparator) Apply(textA string, selected []structChange) (string, error) {
+	if len(selected) == 0 {
+		return textA, nil
+	}
+	request := externalRequest{Action: "apply", Original: textA}
+	for _, change := range selected {
+		request.Changes = append(request.Changes, json.RawMessage(change.text))
+	}
+	response, err := c.run(request)
+	if err != nil {
+		return textA, err
+	}
+	if response.Content == nil {
+		return textA, fmt.Errorf("comparator %s: no content in response", c.Name())
+	}
+	return *response.Content, nil
+}
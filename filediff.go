@@ -2,10 +2,12 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"regexp"
 	"strings"
 
@@ -17,19 +19,73 @@ import (
 // ErrorCanceled is returned when the user decideds to quit.
 var ErrorCanceled = fmt.Errorf("canceled by user")
 
+// ErrorReversed is returned when the user decides to bring the changes
+// into <desired_changes> from <original> instead.
+var ErrorReversed = fmt.Errorf("reversed by user")
+
+// comparison is the outcome of checking if two files differ, before they
+// are reviewed. The changes of files to review are found along with it.
+type comparison struct {
+	fileAExt   fileInfoExtended
+	fileBExt   fileInfoExtended
+	equal      bool
+	comparator Comparator
+	changes    []structChange
+	err        error
+}
+
 // compareFiles is the entry point for file comparison, diff reviews and apply patches
 // TBD: Currently the match result is returned, not sure if we need this or not.
 func compareFiles(fileAExt fileInfoExtended, fileBExt fileInfoExtended, dryRun bool, reportOnly bool) (bool, error) {
-	cmp := equalfile.New(nil, equalfile.Options{}) // compare using single mode
-	equal, err := cmp.CompareFile(fileAExt.osPathname, fileBExt.osPathname)
+	return reviewComparison(compareContent(fileAExt, fileBExt, reportOnly), dryRun, reportOnly)
+}
 
+// compareContent checks if two files differ once the differences that are
+// ignored or substituted are left out. Files whose bytes differ are the same
+// when the comparator for them finds no changes, formatting or key order for
+// example. The changes of files to review are kept, with --reverse in the
+// other direction. It only reads the files so pairs can be compared
+// concurrently.
+func compareContent(fileAExt fileInfoExtended, fileBExt fileInfoExtended, reportOnly bool) comparison {
+	equal, err := filesEqual(fileAExt, fileBExt)
+	if err != nil {
+		return comparison{fileAExt: fileAExt, fileBExt: fileBExt, err: err}
+	}
+	if equal {
+		return comparison{fileAExt: fileAExt, fileBExt: fileBExt, equal: equal}
+	}
+
+	loadFileContent(&fileAExt)
+	loadFileContent(&fileBExt)
+	applySubstitutions(&fileBExt)
+	if reverseDirection && !reportOnly {
+		reverseFiles(&fileAExt, &fileBExt)
+	}
+	comparator, changes := findComparator(fileAExt, fileBExt)
+	if len(changes) == 0 {
+		logDebug("Only ignored differences with " + comparator.Name() + ": " + fileAExt.osPathname + ", " + fileBExt.osPathname)
+		return comparison{fileAExt: fileAExt, fileBExt: fileBExt, equal: true}
+	}
+	return comparison{fileAExt: fileAExt, fileBExt: fileBExt, comparator: comparator, changes: changes}
+}
+
+// reviewComparison reports or reviews the files of a comparison that differ.
+func reviewComparison(compared comparison, dryRun bool, reportOnly bool) (bool, error) {
+	fileAExt, fileBExt, equal, err := compared.fileAExt, compared.fileBExt, compared.equal, compared.err
 	if err != nil {
 		logError("Comparing files failed", err)
 		return false, err
 	}
 
+	if !equal {
+		noticeFallback(compared.comparator, fileAExt, fileBExt)
+		if unifiedPatchPath != "" {
+			recordUnifiedDiff(fileAExt, fileBExt)
+		}
+	}
+
 	if reportOnly && !equal {
-		runtimeStats.FilesWDiff++
+		countStats(func(stats *trackedStats) { stats.FilesWDiff++ })
 		fmt.Printf("Files %s and %s differ\n", fileAExt.osPathname, fileBExt.osPathname)
 		return equal, nil
 	}
@@ -39,18 +95,50 @@ func compareFiles(fileAExt fileInfoExtended, fileBExt fileInfoExtended, dryRun b
 		return equal, nil
 	}
 
-	runtimeStats.FilesWDiff++
-	loadFileContent(&fileAExt)
-	loadFileContent(&fileBExt)
+	countStats(func(stats *trackedStats) { stats.FilesWDiff++ })
+
+	if !dryRun {
+		if err := checkWritable(fileAExt, fileBExt); err != nil {
+			return equal, skipDirty(err)
+		}
+	}
 
-	resultDiffInfo, err := createDiffs(fileAExt, fileBExt)
+	resultDiffInfo, err := reviewChanges(compared.comparator, compared.changes, fileAExt, fileBExt)
+	for errors.Is(err, ErrorReversed) || errors.Is(err, ErrorTool) {
+		if errors.Is(err, ErrorTool) {
+			resolved, toolErr := resolveWithTool(&fileAExt, &fileBExt, dryRun)
+			if toolErr != nil {
+				logError("Running tool failed", toolErr)
+				fmt.Fprintln(os.Stderr)
+			}
+			if resolved {
+				return equal, nil
+			}
+			resultDiffInfo, err = createDiffs(fileAExt, fileBExt)
+			continue
+		}
+		reverseFiles(&fileAExt, &fileBExt)
+		if !dryRun {
+			if err := checkWritable(fileAExt, fileBExt); err != nil {
+				return equal, skipDirty(err)
+			}
+		}
+		resultDiffInfo, err = createDiffs(fileAExt, fileBExt)
+	}
 	if err != nil {
 		return equal, err
 	}
 
-	runtimeStats.PatchesApplied += resultDiffInfo.patchesApplied
-	runtimeStats.PatchesErrored += resultDiffInfo.patchesFailed
-	runtimeStats.PatchesSkipped += (resultDiffInfo.patchesTotal - resultDiffInfo.patchesApplied)
+	patchesApplied := resultDiffInfo.patchesApplied
+	if fileAExt.readOnly {
+		// Nothing is written into files from git, archives or stdin
+		patchesApplied = 0
+	}
+	countStats(func(stats *trackedStats) {
+		stats.PatchesApplied += patchesApplied
+		stats.PatchesErrored += resultDiffInfo.patchesFailed
+		stats.PatchesSkipped += (resultDiffInfo.patchesTotal - patchesApplied)
+	})
 
 	if resultDiffInfo.patchesFailed > 0 {
 		return equal, fmt.Errorf("while patching file, skip file writes: %s", fileAExt.osPathname)
@@ -62,19 +150,112 @@ func compareFiles(fileAExt fileInfoExtended, fileBExt fileInfoExtended, dryRun b
 	}
 
 	// dryrun is off and we have patched the file
+	if !dryRun && resultDiffInfo.desiredPatched {
+		err := writeFileContent(fileBExt, resultDiffInfo.desiredContent)
+		if err != nil {
+			return equal, err
+		}
+	}
 	if !dryRun && resultDiffInfo.patched {
-		err := ioutil.WriteFile(fileAExt.osPathname, resultDiffInfo.newContent, 0644)
+		err := writeFileContent(fileAExt, resultDiffInfo.newContent)
 		return equal, err
 	}
 
 	return equal, nil
 }
 
+// checkWritable checks the files that may be written are safe to patch.
+func checkWritable(fileAExt fileInfoExtended, fileBExt fileInfoExtended) error {
+	if err := checkDirty(fileAExt); err != nil {
+		return err
+	}
+	if writeBoth {
+		return checkDirty(fileBExt)
+	}
+	return nil
+}
+
+// skipDirty warns about a file left alone because it has uncommitted
+// changes, the other files are still reviewed.
+func skipDirty(err error) error {
+	if !errors.Is(err, ErrorDirty) {
+		logError("Refusing to patch", err)
+		return err
+	}
+	countStats(func(stats *trackedStats) { stats.FilesDirty++ })
+	fmt.Fprintf(os.Stderr, "Warning: Skipping, %s\n", err)
+	return nil
+}
+
+// reverseFiles swaps the roles of the files so the changes are brought in
+// from the other side. Substitutions only rewrite the side the changes come
+// from, the file about to be patched is reloaded without them and they are
+// applied again when <desired_changes> is swapped back.
+func reverseFiles(fileAExt *fileInfoExtended, fileBExt *fileInfoExtended) {
+	if fileBExt.substituted {
+		loadFileContent(fileBExt)
+	}
+	autoPatch := fileAExt.autoPatch
+	*fileAExt, *fileBExt = *fileBExt, *fileAExt
+	fileAExt.autoPatch, fileBExt.autoPatch = autoPatch, false
+	if fileBExt.substituted {
+		applySubstitutions(fileBExt)
+	}
+}
+
+// filesEqual does a quick byte comparison, files that are not on disk are read in full.
+// Files on disk are compared by their cached digests unless --no-cache is set.
+func filesEqual(fileAExt fileInfoExtended, fileBExt fileInfoExtended) (bool, error) {
+	if !fileAExt.readOnly && !fileBExt.readOnly {
+		if digests != nil {
+			return digests.equal(fileAExt.osPathname, fileBExt.osPathname)
+		}
+		cmp := equalfile.New(nil, equalfile.Options{}) // compare using single mode
+		return cmp.CompareFile(fileAExt.osPathname, fileBExt.osPathname)
+	}
+	if fileAExt.gitObject != "" && fileAExt.gitObject == fileBExt.gitObject {
+		return true, nil
+	}
+
+	contentA, err := readFileContent(fileAExt)
+	if err != nil {
+		return false, err
+	}
+	contentB, err := readFileContent(fileBExt)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(contentA, contentB), nil
+}
+
+// readFileContent reads a file from disk, a blob from git or the content held in memory.
+func readFileContent(fileX fileInfoExtended) ([]byte, error) {
+	if fileX.memContent != nil {
+		return fileX.memContent, nil
+	}
+	if fileX.gitObject != "" {
+		return gitCommand("cat-file", "blob", fileX.gitObject)
+	}
+	return ioutil.ReadFile(fileX.osPathname)
+}
+
+// writeFileContent writes a patched file, files from git, archives or stdin are read only.
+func writeFileContent(fileX fileInfoExtended, content []byte) error {
+	if fileX.readOnly {
+		fmt.Printf("Read only, skipping file writes: %s\n", fileX.osPathname)
+		return nil
+	}
+	if err := ioutil.WriteFile(fileX.osPathname, content, 0644); err != nil {
+		return err
+	}
+	return stageFile(fileX.osPathname)
+}
+
 // The files have already be read by a quick compare utility
 // If we get an I/O error here we should just exit.
 func loadFileContent(fileX *fileInfoExtended) {
 	var err error
-	fileX.fileContent, err = ioutil.ReadFile(fileX.osPathname)
+	fileX.fileContent, err = readFileContent(*fileX)
 	if err != nil {
 		log.Fatalf("Error reading file: %v, %v", fileX.osPathname, err)
 	}
@@ -93,93 +274,113 @@ func splitLines(s string) []string {
 
 // ColorDiff Returns the diff to the end user with colour
 func ColorDiff(diffs []diffmatchpatch.Diff) string {
-	r := regexp.MustCompile(`\s+(\r?\n)`)
-	rEnd := regexp.MustCompile(`\s+$`)
+	dmp := diffmatchpatch.New()
 	out := ""
-	for i, diff := range diffs {
-		if i == 0 {
-			out += color.Style{color.Blue}.Sprint("---\n")
-		}
-		switch diff.Type {
-		case diffmatchpatch.DiffInsert:
-			// out += color.Style{color.Green}.Sprint(strings.ReplaceAll(diff.Text, "\t", "˲   "))
-			if diff.Text == r.ReplaceAllString(diff.Text, "$1") {
-				out += color.Style{color.Green}.Sprint(strings.ReplaceAll(diff.Text, "\t", "˲   "))
-			} else {
-				lines := splitLines(diff.Text)
-				for i, line := range lines {
-					noSpaceLine := rEnd.ReplaceAllString(line, "")
-					out += color.Style{color.Green}.Sprint(strings.ReplaceAll(noSpaceLine, "\t", "˲   "))
-					out += color.Style{color.BgGreen}.Sprint(strings.Replace(line, noSpaceLine, "", 1))
-					if i+1 != len(lines) {
-						out += color.ClearCode("\n")
-					}
-				}
-				if strings.HasSuffix(diff.Text, "\n") {
-					out += color.ClearCode("\n")
-				}
-			}
-		case diffmatchpatch.DiffDelete:
-			// out += color.Style{color.Red}.Sprint(strings.ReplaceAll(diff.Text, "\t", "˲   "))
-			if diff.Text == r.ReplaceAllString(diff.Text, "$1") {
-				out += color.Style{color.Red}.Sprint(strings.ReplaceAll(diff.Text, "\t", "˲   "))
-			} else {
-				lines := splitLines(diff.Text)
-				for i, line := range lines {
-					noSpaceLine := rEnd.ReplaceAllString(line, "")
-					out += color.Style{color.Red}.Sprint(strings.ReplaceAll(noSpaceLine, "\t", "˲   "))
-					out += color.Style{color.BgRed}.Sprint(strings.Replace(line, noSpaceLine, "", 1))
-					if i+1 != len(lines) {
-						out += color.ClearCode("\n")
-					}
-				}
-				if strings.HasSuffix(diff.Text, "\n") {
-					out += color.ClearCode("\n")
-				}
+	for _, hunk := range groupHunks(diffs, diffContext) {
+		out += color.Style{color.Blue}.Sprint("---\n")
+		for i := 0; i < len(hunk.diffs); i++ {
+			diff := hunk.diffs[i]
+			if wordDiff != "none" && diff.Type == diffmatchpatch.DiffDelete &&
+				i+1 < len(hunk.diffs) && hunk.diffs[i+1].Type == diffmatchpatch.DiffInsert {
+				// Show the replaced lines once with only the changed words highlighted
+				out += wordDiffString(dmp, diff.Text, hunk.diffs[i+1].Text, wordDiff)
+				i++
+				continue
 			}
-		case diffmatchpatch.DiffEqual:
-			lines := splitLines(diff.Text)
-			if len(lines) > 0 &&
-				// Avoid just adding the beginning of the file as context if it is not close to the diff
-				!(i == 0 && len(lines) > 2) {
 
+			switch diff.Type {
+			case diffmatchpatch.DiffInsert:
+				out += colorChange(diff.Text, color.Green, color.BgGreen)
+			case diffmatchpatch.DiffDelete:
+				out += colorChange(diff.Text, color.Red, color.BgRed)
+			case diffmatchpatch.DiffEqual:
 				// TODO: Control the output of tab with an option
-				out += color.Style{color.White}.Sprint(strings.ReplaceAll(lines[0], "\t", "˲   "))
-				if len(lines) > 1 {
-					out += "\n"
-				}
-				if len(lines) > 2 {
-					out += color.Style{color.Blue}.Sprint("\n---\n")
-				}
+				out += color.Style{color.White}.Sprint(strings.ReplaceAll(diff.Text, "\t", "˲   "))
 			}
-			if len(lines) > 1 &&
-				// Avoid just adding the end of the file as context if it is not close to the diff
-				!(i+1 == len(diffs) && len(lines) > 2) {
+		}
+	}
+	if out != "" {
+		out += color.Style{color.Blue}.Sprint("---\n")
+	}
+	return out
+}
 
-				// TODO: Control the output of tab with an option
-				out += color.Style{color.White}.Sprint(strings.ReplaceAll(lines[len(lines)-1], "\t", "˲   "))
-				if strings.HasSuffix(diff.Text, "\n") {
-					out += "\n"
-				}
-			}
+// colorChange colours an inserted or deleted block of text, trailing
+// white space is highlighted with the background colour so it stands out.
+func colorChange(text string, fg color.Color, bg color.Color) string {
+	r := regexp.MustCompile(`\s+(\r?\n)`)
+	rEnd := regexp.MustCompile(`\s+$`)
+	out := ""
+
+	if text == r.ReplaceAllString(text, "$1") {
+		return color.Style{fg}.Sprint(strings.ReplaceAll(text, "\t", "˲   "))
+	}
+
+	lines := splitLines(text)
+	for i, line := range lines {
+		noSpaceLine := rEnd.ReplaceAllString(line, "")
+		out += color.Style{fg}.Sprint(strings.ReplaceAll(noSpaceLine, "\t", "˲   "))
+		out += color.Style{bg}.Sprint(strings.Replace(line, noSpaceLine, "", 1))
+		if i+1 != len(lines) {
+			out += color.ClearCode("\n")
 		}
 	}
+	if strings.HasSuffix(text, "\n") {
+		out += color.ClearCode("\n")
+	}
 	return out
 }
 
-// Get a list of Patches / Chunks
+// createDiffs reviews the changes between two files with the comparator for their type.
 func createDiffs(fileAExt fileInfoExtended, fileBExt fileInfoExtended) (fileDiffInfo, error) {
+	comparator, changes := findComparator(fileAExt, fileBExt)
+	return reviewChanges(comparator, changes, fileAExt, fileBExt)
+}
+
+// reviewChanges reviews the changes a comparator found between two files.
+func reviewChanges(comparator Comparator, changes []structChange, fileAExt fileInfoExtended, fileBExt fileInfoExtended) (fileDiffInfo, error) {
+	if r, ok := comparator.(reviewer); ok {
+		resultDiffInfo, err := r.Review(fileAExt, fileBExt, changes)
+		if err == nil && resultDiffInfo.patched && jsonPatchPath != "" && matchGlobs(jsonGlobs, fileAExt.osPathname) {
+			// Not compared by value, the JSON Patch replaces the whole document
+			recordJSONDocument(fileAExt.osPathname, resultDiffInfo.newContent)
+		}
+		return resultDiffInfo, err
+	}
+	return reviewStructChanges(comparator, fileAExt, fileBExt, changes)
+}
+
+// Review asks about every hunk of the line diff, with the merge answers.
+func (c lineComparator) Review(fileAExt fileInfoExtended, fileBExt fileInfoExtended, changes []structChange) (fileDiffInfo, error) {
 
 	fileDiffInfo := fileDiffInfo{}
 
-	dmp := diffmatchpatch.New()
-	dmp.MatchMaxBits = 100
+	var review func(diffHunk) bool
+	if promoted, ok := promotedHunks[fileBExt.osPathname]; ok {
+		// Reviewed for an earlier target, only the hunks that do not apply cleanly are asked about again
+		text, failed := applyPromotedHunks(promoted, fileAExt.fileContentString)
+		fileDiffInfo.patchesTotal = len(promoted) - len(failed)
+		fileDiffInfo.patchesApplied = len(promoted) - len(failed)
+		if fileDiffInfo.patchesApplied > 0 {
+			fileDiffInfo.patched = true
+			fileDiffInfo.newContent = []byte(text)
+		}
+		fmt.Printf("Promoted to: %s, from: %s, Hunks: %v, Applied: %v\n", fileAExt.osPathname, fileBExt.osPathname, len(promoted), fileDiffInfo.patchesApplied)
+		if len(failed) == 0 {
+			return fileDiffInfo, nil
+		}
+		color.Style{color.OpBold}.Printf("Hunks not applying cleanly: %v, reviewing them again\n", len(failed))
+		fileAExt.fileContentString = text
+		fileAExt.fileContent = []byte(text)
+		changes, _ = c.Diff(fileAExt.fileContentString, fileBExt.fileContentString)
+		review = func(hunk diffHunk) bool { return touchesPromotedHunks(hunk, failed) }
+	}
 
-	// create the diffs between files
-	fileAdmp, fileBdmp, dmpStrings := dmp.DiffLinesToChars(fileAExt.fileContentString, fileBExt.fileContentString)
-	diffs := dmp.DiffMain(fileAdmp, fileBdmp, false)
-	diffs = dmp.DiffCharsToLines(diffs, dmpStrings)
-	diffs = dmp.DiffCleanupSemantic(diffs)
+	// every change holds the diff of the whole file
+	diffs := []diffmatchpatch.Diff{}
+	if len(changes) > 0 {
+		diffs = changes[0].line.diffs
+	}
 
 	fileDiffInfo.diffCount = len(diffs)
 	//review the diff with the user
@@ -189,19 +390,30 @@ func createDiffs(fileAExt fileInfoExtended, fileBExt fileInfoExtended) (fileDiff
 	}
 
 	if !lookAtPatches {
+		recordPromotedHunks(fileBExt, nil)
 		return fileDiffInfo, nil
 	}
 
-	fileContent, patchesTotal, patchesFailed, err := handlePatches(dmp, diffs, fileAExt)
+	fileContent, desiredContent, applyHunkList, patchesFailed, err := c.handlePatches(changes, fileAExt, review)
+	if err == nil {
+		recordPromotedHunks(fileBExt, applyHunkList)
+	}
+	patchesTotal := len(applyHunkList)
 	patchesApplied := patchesTotal - patchesFailed
 
-	fileDiffInfo.patchesTotal = patchesTotal
-	fileDiffInfo.patchesApplied = patchesApplied
+	fileDiffInfo.patchesTotal += patchesTotal
+	fileDiffInfo.patchesApplied += patchesApplied
 	fileDiffInfo.patchesFailed = patchesFailed
 
 	if patchesApplied > 0 {
-		fileDiffInfo.patched = true
-		fileDiffInfo.newContent = fileContent
+		if string(fileContent) != fileAExt.fileContentString {
+			fileDiffInfo.patched = true
+			fileDiffInfo.newContent = fileContent
+		}
+		if desiredContent != nil && string(desiredContent) != fileBExt.fileContentString {
+			fileDiffInfo.desiredPatched = true
+			fileDiffInfo.desiredContent = desiredContent
+		}
 	}
 
 	logError("Error applying patching", err)
@@ -215,100 +427,122 @@ func reviewDiff(mydiffString string, fileAName string, fileBName string, autoPat
 
 	response := false
 	if autoPatch {
-		fmt.Print("Review patches and apply them [y,n,q]? AutoAppling")
+		fmt.Printf("Review patches and apply them [%s]? AutoAppling", reviewAnswers())
 		response = true
 	} else {
-		color.Style{color.Blue, color.OpBold}.Print("Review patches and apply them [y,n,q]? ")
-		rsp, err := askForConfirmation()
+		color.Style{color.Blue, color.OpBold}.Printf("Review patches and apply them [%s]? ", reviewAnswers())
+		rsp, err := askForResponse(true)
 		if err != nil {
-			if errors.Is(err, ErrorCanceled) {
-				return rsp, err
-			}
+			return rsp, err
 		}
 		response = rsp
 	}
 	return response, nil
 }
 
-func reviewPatchDetailed(patchString string, fileAName string, autoPatch bool) (bool, error) {
+func reviewPatchDetailed(patchString string, fileAName string, autoPatch bool) (hunkResolution, error) {
 	color.Style{color.OpBold}.Printf("Appling diff to: %s\n", fileAName)
 	fmt.Println(patchString)
 
-	response := false
+	response := resolveSkip
 	if autoPatch {
-		fmt.Print("Apply patch [y,n,q]? AutoAppling")
-		response = true
+		fmt.Print("Apply patch [y,n,o,a,b,q]? AutoAppling")
+		response = resolveDesired
 	} else {
-		color.Style{color.Blue, color.OpBold}.Print("Apply patch [y,n,q]? ")
-		rsp, err := askForConfirmation()
+		color.Style{color.Blue, color.OpBold}.Print("Apply patch [y,n,o,a,b,q]? ")
+		rsp, err := askForResolution()
 		if err != nil {
-			if errors.Is(err, ErrorCanceled) {
-				return rsp, err
-			}
+			return rsp, err
 		}
 		response = rsp
 	}
 	return response, nil
 }
 
-func handlePatches(dmp *diffmatchpatch.DiffMatchPatch, diffs []diffmatchpatch.Diff, fileAExt fileInfoExtended) ([]byte, int, int, error) {
+// handlePatches applies the hunks the user selects, it returns the new
+// content, the selected hunks and how many of them failed to apply.
+// With --write-both the new content of the desired file is returned too.
+// When review is set only the hunks it returns true for are asked about.
+func (c lineComparator) handlePatches(changes []structChange, fileAExt fileInfoExtended, review func(diffHunk) bool) ([]byte, []byte, []diffHunk, int, error) {
 
-	myPatches := dmp.PatchMake(diffs)
-	applyPatchList, err := stagePatches(myPatches, fileAExt.osPathname, fileAExt.autoPatch)
+	hunks := []diffHunk{}
+	for _, change := range changes {
+		if review == nil || review(change.line.hunk) {
+			hunks = append(hunks, change.line.hunk)
+		}
+	}
+	applyHunkList, err := stagePatches(hunks, fileAExt.osPathname, fileAExt.autoPatch)
 
 	if err != nil {
 		fmt.Println(err)
-		return nil, 0, 0, err
+		return nil, nil, nil, 0, err
 	}
 
-	fileAtextnew, patchResults := dmp.PatchApply(applyPatchList, fileAExt.fileContentString)
+	if writeBoth {
+		fileAtextnew, fileBtextnew := mergeHunks(changes[0].line.diffs, applyHunkList)
+		return []byte(fileAtextnew), []byte(fileBtextnew), applyHunkList, 0, nil
+	}
 
-	patchesTotal := 0
-	patchesFailed := 0
-	for _, patchResult := range patchResults {
-		patchesTotal++
-		if !patchResult {
-			patchesFailed++
+	// the change of every selected hunk takes the lines it was resolved to
+	selected := []structChange{}
+	for _, hunk := range applyHunkList {
+		for _, change := range changes {
+			if change.line.hunk.first == hunk.first {
+				_, change.text = resolveHunk(hunk, hunk.resolution)
+				selected = append(selected, change)
+			}
 		}
 	}
+	fileAtextnew, err := c.Apply(fileAExt.fileContentString, selected)
+	if err != nil {
+		return nil, nil, applyHunkList, len(applyHunkList), err
+	}
 
-	fileContent := []byte(fileAtextnew)
-
-	return fileContent, patchesTotal, patchesFailed, err
+	return []byte(fileAtextnew), nil, applyHunkList, 0, nil
 }
 
-// Cycles through the patches and returns the patches the User has flagged to be applied.
-func stagePatches(myPatches []diffmatchpatch.Patch, fileAName string, autoPatch bool) ([]diffmatchpatch.Patch, error) {
+// Cycles through the hunks and returns the hunks the User has flagged to be applied.
+func stagePatches(hunks []diffHunk, fileAName string, autoPatch bool) ([]diffHunk, error) {
 
-	applyPatchList := []diffmatchpatch.Patch{}
+	applyHunkList := []diffHunk{}
 
-	for _, patch := range myPatches {
-		addChunk, err := reviewPatchDetailed(patch.StringByLine(), fileAName, autoPatch)
+	for _, hunk := range hunks {
+		resolution, err := reviewPatchDetailed(hunk.String(), fileAName, autoPatch)
 		if err != nil {
 			logError("Error reviewing patch", err)
-			return applyPatchList, err
+			return applyHunkList, err
 		}
-		if addChunk {
-			applyPatchList = append(applyPatchList, patch)
+		if resolution == resolveSkip || (resolution == resolveOriginal && !writeBoth) {
+			// Nothing changes in either file
+			continue
 		}
+		hunk.resolution = resolution
+		applyHunkList = append(applyHunkList, hunk)
 	}
 
-	return applyPatchList, nil
+	return applyHunkList, nil
 }
 
 // Helper method to ask for confirmation from a User
 func askForConfirmation() (bool, error) {
-	var response string
+	return askForResponse(false)
+}
 
-	_, err := fmt.Scanln(&response)
+// reviewAnswers lists the answers to the review of a file.
+func reviewAnswers() string {
+	if mergeToolCommand != nil {
+		return "y,n,r,t,q"
+	}
+	return "y,n,r,q"
+}
+
+// askForResponse asks for confirmation, when allowReverse is set the
+// answer r is accepted too and returned as ErrorReversed, and with a
+// --tool the answer t is returned as ErrorTool.
+func askForResponse(allowReverse bool) (bool, error) {
+	response, err := readAnswer()
 	if err != nil {
-		if err.Error() == "unexpected newline" {
-			response = ""
-		} else {
-			logError("Error during confirmation", err)
-			// TODO: Should this still be nil?
-			return false, nil
-		}
+		return false, err
 	}
 
 	switch strings.ToLower(response) {
@@ -318,11 +552,59 @@ func askForConfirmation() (bool, error) {
 		return false, nil
 	case "q", "quit":
 		return false, ErrorCanceled
+	case "r", "reverse":
+		if allowReverse {
+			return false, ErrorReversed
+		}
+	case "t", "tool":
+		if allowReverse && mergeToolCommand != nil {
+			return false, ErrorTool
+		}
+	}
+
+	fmt.Print(`y - patch this hunk
+n - do not patch this hunk
+`)
+	if allowReverse {
+		fmt.Print(`r - reverse; patch the other file from this one instead
+`)
+	}
+	if allowReverse && mergeToolCommand != nil {
+		fmt.Printf("t - tool; resolve the file in %s, then review what still differs\n", mergeToolCommand[0])
+	}
+	fmt.Print(`q - quit; do not patch this hunk or any of the remaining ones
+`)
+	return askForResponse(allowReverse)
+}
+
+// askForResolution asks the user what to do with a hunk.
+func askForResolution() (hunkResolution, error) {
+	response, err := readAnswer()
+	if err != nil {
+		return resolveSkip, err
+	}
+
+	switch strings.ToLower(response) {
+	case "y", "yes":
+		return resolveDesired, nil
+	case "n", "no":
+		return resolveSkip, nil
+	case "o", "original":
+		return resolveOriginal, nil
+	case "a":
+		return resolveOriginalThenDesired, nil
+	case "b":
+		return resolveDesiredThenOriginal, nil
+	case "q", "quit":
+		return resolveSkip, ErrorCanceled
 	default:
-		fmt.Print(`y - patch this hunk
+		fmt.Print(`y - patch this hunk with the desired lines
 n - do not patch this hunk
+o - keep the original lines, with --write-both they replace the desired lines
+a - keep the original lines followed by the desired lines
+b - use the desired lines followed by the original lines
 q - quit; do not patch this hunk or any of the remaining ones
 `)
-		return askForConfirmation()
+		return askForResolution()
 	}
 }
@@ -2,9 +2,11 @@ package main
 
 import (
 	"errors"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -32,8 +34,7 @@ func loadTestFile(fileName string) fileInfoExtended {
 }
 
 func Test_askForConfirmation(t *testing.T) {
-	oldStdin := os.Stdin
-	defer func() { os.Stdin = oldStdin }() // Restore original Stdin
+	defer func() { prompts = nil }()
 
 	tests := []struct {
 		name string
@@ -47,18 +48,11 @@ func Test_askForConfirmation(t *testing.T) {
 		{"N", false, nil},
 		{"no", false, nil},
 		{"q", false, ErrorCanceled},
-		{"blabla", false, nil},
+		{"blabla", false, io.EOF},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tmpfile, err := ioutil.TempFile("", "utesttmp.txt")
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			os.Stdin = tmpfile
-
-			updateStdInContent(tmpfile, tt.name)
+			setAnswers(tt.name)
 			got, err := askForConfirmation()
 			if got != tt.want {
 				t.Errorf("askForConfirmation() = %v, want %v", got, tt.want)
@@ -72,17 +66,45 @@ func Test_askForConfirmation(t *testing.T) {
 			if err != nil && tt.err != nil && !errors.Is(err, tt.err) {
 				t.Errorf("askForConfirmation() = %v, want %v", err, tt.err)
 			}
+		})
+	}
 
-			os.Remove(tmpfile.Name())
-			if err := tmpfile.Close(); err != nil {
-				log.Fatal(err)
+}
+
+func Test_askForResponse(t *testing.T) {
+	defer func() { prompts = nil }()
+
+	tests := []struct {
+		name         string
+		input        string
+		allowReverse bool
+		want         bool
+		err          error
+	}{
+		{"Yes", "y", true, true, nil},
+		{"Reverse", "r", true, false, ErrorReversed},
+		{"ReverseLong", "reverse", true, false, ErrorReversed},
+		{"ReverseNotAllowed", "r\ny", false, true, nil},
+		{"Quit", "q", true, false, ErrorCanceled},
+		{"ToolNotSet", "t\ny", true, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAnswers(tt.input)
+
+			got, err := askForResponse(tt.allowReverse)
+			if got != tt.want {
+				t.Errorf("askForResponse() = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("askForResponse() error = %v, want %v", err, tt.err)
 			}
 		})
 	}
-
 }
 
 func Test_reviewDiff(t *testing.T) {
+	defer func() { prompts = nil }()
 	type args struct {
 		mydiffString string
 		fileAName    string
@@ -100,6 +122,7 @@ func Test_reviewDiff(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			setAnswers("n\n")
 			got, err := reviewDiff(tt.args.mydiffString, tt.args.fileAName, tt.args.fileBName, tt.args.autoApply)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("reviewDiff() error = %v, wantErr %v", err, tt.wantErr)
@@ -113,6 +136,7 @@ func Test_reviewDiff(t *testing.T) {
 }
 
 func Test_reviewPatchDetailed(t *testing.T) {
+	defer func() { prompts = nil }()
 	type args struct {
 		patchString string
 		fileAName   string
@@ -121,14 +145,15 @@ func Test_reviewPatchDetailed(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    bool
+		want    hunkResolution
 		wantErr bool
 	}{
-		{"SimpleTest1", args{patchString: "Test1", fileAName: "FileA", autoApply: true}, true, false},
-		{"SimpleTest2", args{patchString: "Test2", fileAName: "FileA", autoApply: false}, false, false},
+		{"SimpleTest1", args{patchString: "Test1", fileAName: "FileA", autoApply: true}, resolveDesired, false},
+		{"SimpleTest2", args{patchString: "Test2", fileAName: "FileA", autoApply: false}, resolveSkip, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			setAnswers("n\n")
 			got, err := reviewPatchDetailed(tt.args.patchString, tt.args.fileAName, tt.args.autoApply)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("reviewPatchDetailed() error = %v, wantErr %v", err, tt.wantErr)
@@ -162,6 +187,7 @@ func Test_loadFileContent(t *testing.T) {
 }
 
 func Test_createDiffs(t *testing.T) {
+	defer func() { prompts = nil }()
 
 	fileA := loadTestFile("testdata/same/a/t1.txt")
 	loadFileContent(&fileA)
@@ -217,6 +243,7 @@ func Test_createDiffs(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			setAnswers("n\n")
 			got, err := createDiffs(tt.args.fileAExt, tt.args.fileBExt)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("createDiffs() error = %v, wantErr %v", err, tt.wantErr)
@@ -230,6 +257,7 @@ func Test_createDiffs(t *testing.T) {
 }
 
 func Test_compareFiles(t *testing.T) {
+	defer func() { prompts = nil }()
 
 	fileA := loadTestFile("testdata/same/a/t1.txt")
 	fileB := loadTestFile("testdata/same/b/t1.txt")
@@ -289,6 +317,7 @@ func Test_compareFiles(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			setAnswers("n\n")
 			got, err := compareFiles(tt.args.fileAExt, tt.args.fileBExt, tt.args.dryRun, tt.args.reportOnly)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("compareFiles() error = %v, wantErr %v", err, tt.wantErr)
@@ -300,3 +329,52 @@ func Test_compareFiles(t *testing.T) {
 		})
 	}
 }
+
+func Test_compareFilesReverse(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer func() { reverseDirection = false }()
+
+	original, _ := ioutil.ReadFile("testdata/smalldiff/t1.txt")
+	desired, _ := ioutil.ReadFile("testdata/smalldiff/t2.txt")
+
+	tests := []struct {
+		name    string
+		reverse bool
+		input   string
+		wantA   []byte
+		wantB   []byte
+	}{
+		{"Forward", false, "y\ny\ny\ny\ny\n", desired, desired},
+		{"Flag", true, "y\ny\ny\ny\ny\n", original, original},
+		{"Answer", false, "r\ny\ny\ny\ny\ny\n", original, original},
+		{"AnswerTwice", false, "r\nr\ny\ny\ny\ny\ny\n", desired, desired},
+		{"FlagAndAnswer", true, "r\ny\ny\ny\ny\ny\n", desired, desired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "reverse")
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+			fileA := writeTestFile(filepath.Join(tmpDir, "a.txt"), string(original))
+			fileB := writeTestFile(filepath.Join(tmpDir, "b.txt"), string(desired))
+
+			setAnswers(tt.input)
+
+			reverseDirection = tt.reverse
+			if _, err := compareFiles(fileA, fileB, false, false); err != nil {
+				t.Errorf("compareFiles() error = %v", err)
+			}
+
+			gotA, _ := ioutil.ReadFile(fileA.osPathname)
+			gotB, _ := ioutil.ReadFile(fileB.osPathname)
+			if !reflect.DeepEqual(gotA, tt.wantA) {
+				t.Errorf("compareFiles() original = %q, want %q", gotA, tt.wantA)
+			}
+			if !reflect.DeepEqual(gotB, tt.wantB) {
+				t.Errorf("compareFiles() desired = %q, want %q", gotB, tt.wantB)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitPrefix marks an argument read from the local git repository
+// instead of the filesystem, in the form git:<rev>:<path>.
+const gitPrefix = "git:"
+
+// virtualFileInfo describes a file or directory that is not on disk,
+// a blob or tree from git or an entry of an archive.
+type virtualFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi virtualFileInfo) Name() string       { return fi.name }
+func (fi virtualFileInfo) Size() int64        { return fi.size }
+func (fi virtualFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi virtualFileInfo) IsDir() bool        { return fi.dir }
+func (fi virtualFileInfo) Sys() interface{}   { return nil }
+func (fi virtualFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// parseGitPath splits git:<rev>:<path>, the path is relative to the current directory.
+func parseGitPath(arg string) (string, string, bool) {
+	if !strings.HasPrefix(arg, gitPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(arg, gitPrefix), ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", false
+	}
+	gitPath := filepath.ToSlash(filepath.Clean(parts[1]))
+	return parts[0], gitPath, true
+}
+
+// gitCommand runs git in the current directory and returns its output.
+func gitCommand(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// statGitPath returns the blob or tree at gitPath in a git revision.
+func statGitPath(rev string, gitPath string) (fileInfoExtended, error) {
+	object := rev + ":./" + gitPath
+	// rev-parse --verify --quiet exits with 1 when the revision or path does not exist
+	oid, err := gitCommand("rev-parse", "--verify", "--quiet", object)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return fileInfoExtended{}, fmt.Errorf("%s%s:%s: %w", gitPrefix, rev, gitPath, os.ErrNotExist)
+	}
+	if err != nil {
+		return fileInfoExtended{}, err
+	}
+	objectType, err := gitCommand("cat-file", "-t", object)
+	if err != nil {
+		return fileInfoExtended{}, err
+	}
+
+	fileInfo := virtualFileInfo{name: path.Base(gitPath), dir: strings.TrimSpace(string(objectType)) == "tree"}
+	if !fileInfo.dir {
+		size, err := gitCommand("cat-file", "-s", object)
+		if err != nil {
+			return fileInfoExtended{}, err
+		}
+		fileInfo.size, _ = strconv.ParseInt(strings.TrimSpace(string(size)), 10, 64)
+	}
+
+	return fileInfoExtended{
+		osPathname: gitPrefix + rev + ":" + gitPath,
+		fileInfo:   fileInfo,
+		gitRev:     rev,
+		gitPath:    gitPath,
+		gitObject:  strings.TrimSpace(string(oid)),
+		readOnly:   true,
+	}, nil
+}
+
+// getAllGitFiles is getAllFiles for a directory in a git revision.
+// Symlinks and submodules are skipped, there is nothing to follow.
+func getAllGitFiles(root fileInfoExtended) []fileInfoExtended {
+	foundFiles := []fileInfoExtended{}
+	fmt.Println("Loading files from ", root.osPathname)
+
+	out, err := gitCommand("ls-tree", "-r", "-t", "-z", "--long", root.gitRev, "--", root.gitPath)
+	if err != nil {
+		logError("Error searching for file", err)
+		return foundFiles
+	}
+
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> SP <size> TAB <path>
+		tab := strings.Index(entry, "\t")
+		if tab == -1 {
+			continue
+		}
+		fields := strings.Fields(entry[:tab])
+		entryPath := entry[tab+1:]
+		if len(fields) != 4 {
+			continue
+		}
+
+		relPath := entryPath
+		if root.gitPath != "." {
+			if !strings.HasPrefix(entryPath, root.gitPath+"/") {
+				continue
+			}
+			relPath = strings.TrimPrefix(entryPath, root.gitPath+"/")
+		} else if entryPath == "./" {
+			continue
+		}
+
+		osPathname := root.osPathname + "/" + relPath
+		logDebug("Checking file:" + osPathname)
+		if skipPath(osPathname) {
+			continue
+		}
+
+		switch {
+		case fields[1] == "tree":
+			countStats(func(stats *trackedStats) { stats.DirSearched++ })
+		case fields[1] == "blob" && fields[0] != "120000":
+			size, _ := strconv.ParseInt(fields[3], 10, 64)
+			logDebug("Including file:" + osPathname)
+			foundFiles = append(foundFiles, fileInfoExtended{
+				osPathname: osPathname,
+				fileInfo:   virtualFileInfo{name: path.Base(relPath), size: size},
+				gitRev:     root.gitRev,
+				gitPath:    root.gitPath + "/" + relPath,
+				gitObject:  fields[2],
+				readOnly:   true,
+			})
+			countStats(func(stats *trackedStats) { stats.FilesScanned++ })
+		default:
+			logDebug("Skipping symlink or submodule:" + osPathname)
+		}
+	}
+
+	return foundFiles
+}
+
+// ErrorDirty is returned for a file that is not patched because it has uncommitted changes.
+var ErrorDirty = errors.New("file has uncommitted changes, commit them or use --allow-dirty")
+
+// dirtyTrees holds the files with uncommitted changes below each root
+// being compared, a directory or a single file, so git status runs once
+// per root instead of once per file.
+var dirtyTrees map[string]map[string]bool
+
+// loadDirtyFiles lists the files with uncommitted changes below root.
+// Untracked files are not work that can be lost by patching them.
+func loadDirtyFiles(root fileInfoExtended) {
+	if allowDirty || root.readOnly {
+		return
+	}
+	rootPath, err := filepath.Abs(root.osPathname)
+	if err != nil {
+		return
+	}
+	dir, pathspec := rootPath, "."
+	if !root.fileInfo.IsDir() {
+		dir, pathspec = filepath.Dir(rootPath), filepath.Base(rootPath)
+	}
+
+	prefix, err := gitCommand("-C", dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		logDebug("Skipping dirty check: " + err.Error())
+		return
+	}
+	out, err := gitCommand("-C", dir, "status", "--porcelain", "-z", "--untracked-files=no", "--", pathspec)
+	if err != nil {
+		logDebug("Skipping dirty check: " + err.Error())
+		return
+	}
+	dirty := map[string]bool{}
+	// Paths are relative to the top of the repository, a rename is followed by its source
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		gitPath := strings.TrimPrefix(entry[3:], strings.TrimSpace(string(prefix)))
+		dirty[filepath.Join(dir, filepath.FromSlash(gitPath))] = true
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+	}
+	if dirtyTrees == nil {
+		dirtyTrees = map[string]map[string]bool{}
+	}
+	dirtyTrees[rootPath] = dirty
+}
+
+// fileDirty reports if a file has uncommitted changes, from the root it
+// belongs to when one was loaded. Untracked files and files outside of a
+// git repository are never dirty.
+func fileDirty(osPathname string) bool {
+	if abs, err := filepath.Abs(osPathname); err == nil {
+		for root, dirty := range dirtyTrees {
+			if abs == root || strings.HasPrefix(abs, root+string(filepath.Separator)) {
+				return dirty[abs]
+			}
+		}
+	}
+
+	out, err := gitCommand("-C", filepath.Dir(osPathname), "status", "--porcelain", "--untracked-files=no", "--", filepath.Base(osPathname))
+	if err != nil {
+		logDebug("Skipping dirty check: " + err.Error())
+		return false
+	}
+	return len(bytes.TrimSpace(out)) > 0
+}
+
+// checkDirty refuses to patch a file with uncommitted changes unless --allow-dirty is set.
+func checkDirty(fileX fileInfoExtended) error {
+	if allowDirty || fileX.readOnly {
+		return nil
+	}
+	if fileDirty(fileX.osPathname) {
+		return fmt.Errorf("%w: %s", ErrorDirty, fileX.osPathname)
+	}
+	return nil
+}
+
+// stageFile adds a written, moved or removed file to the git index when --git-stage is set.
+func stageFile(osPathname string) error {
+	if !gitStage {
+		return nil
+	}
+	_, err := gitCommand("-C", filepath.Dir(osPathname), "add", "-A", "--", filepath.Base(osPathname))
+	return err
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// setupGitRepo creates a repository with a v1 tag and changes on top,
+// then changes into it. The returned func restores the working directory.
+func setupGitRepo(t *testing.T) func() {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "gitrepo")
+	if err != nil {
+		log.Fatal(err)
+	}
+	oldDir, _ := os.Getwd()
+
+	writeTestFile(filepath.Join(tmpDir, "envs/dev/main.tf"), "version = \"5.0.6\"\n")
+	writeTestFile(filepath.Join(tmpDir, "envs/dev/modules/vars.tf"), "variable \"a\" {}\n")
+	writeTestFile(filepath.Join(tmpDir, "envs/dev/.hidden"), "secret\n")
+	if err := os.Symlink("main.tf", filepath.Join(tmpDir, "envs/dev/link.tf")); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.Chdir(tmpDir); err != nil {
+		log.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+		{"tag", "v1"},
+	} {
+		if _, err := gitCommand(args...); err != nil {
+			log.Fatal(err)
+		}
+	}
+	writeTestFile("envs/dev/main.tf", "version = \"5.0.8\"\n")
+
+	return func() {
+		os.Chdir(oldDir)
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func Test_parseGitPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     string
+		wantRev string
+		want    string
+		wantOk  bool
+	}{
+		{"Plain", "envs/dev", "", "", false},
+		{"Tag", "git:v1.4:envs/dev", "v1.4", "envs/dev", true},
+		{"Clean", "git:HEAD~1:./envs/dev/", "HEAD~1", "envs/dev", true},
+		{"Current", "git:HEAD:", "HEAD", ".", true},
+		{"PathWithColon", "git:main:a:b", "main", "a:b", true},
+		{"MissingPath", "git:HEAD", "", "", false},
+		{"MissingRev", "git::envs", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rev, gitPath, ok := parseGitPath(tt.arg)
+			if rev != tt.wantRev || gitPath != tt.want || ok != tt.wantOk {
+				t.Errorf("parseGitPath() = %v, %v, %v, want %v, %v, %v", rev, gitPath, ok, tt.wantRev, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_statArgument(t *testing.T) {
+	defer setupGitRepo(t)()
+
+	tests := []struct {
+		name        string
+		arg         string
+		wantDir     bool
+		wantErr     bool
+		wantMissing bool
+	}{
+		{"Dir", "git:v1:envs/dev", true, false, false},
+		{"File", "git:v1:envs/dev/main.tf", false, false, false},
+		{"Root", "git:v1:.", true, false, false},
+		{"Disk", "envs/dev/main.tf", false, false, false},
+		{"MissingPath", "git:v1:envs/prod", false, true, true},
+		{"MissingRev", "git:v2:envs/dev", false, true, true},
+		{"MissingDisk", "envs/prod", false, true, true},
+		{"NotADirectory", "envs/dev/main.tf/vars.tf", false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := statArgument(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("statArgument() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if errors.Is(err, os.ErrNotExist) != tt.wantMissing {
+				t.Errorf("statArgument() error = %v, wantMissing %v", err, tt.wantMissing)
+			}
+			if !tt.wantErr && got.fileInfo.IsDir() != tt.wantDir {
+				t.Errorf("statArgument() IsDir = %v, want %v", got.fileInfo.IsDir(), tt.wantDir)
+			}
+		})
+	}
+}
+
+func Test_getAllGitFiles(t *testing.T) {
+	defer setupGitRepo(t)()
+	defer func() { includeHidden = false }()
+
+	tests := []struct {
+		name   string
+		arg    string
+		hidden bool
+		want   []string
+	}{
+		{"Dir", "git:v1:envs/dev", false, []string{"git:v1:envs/dev/main.tf", "git:v1:envs/dev/modules/vars.tf"}},
+		{"Hidden", "git:v1:envs/dev", true, []string{"git:v1:envs/dev/.hidden", "git:v1:envs/dev/main.tf", "git:v1:envs/dev/modules/vars.tf"}},
+		{"Subdir", "git:v1:envs/dev/modules", false, []string{"git:v1:envs/dev/modules/vars.tf"}},
+		{"Root", "git:v1:.", false, []string{"git:v1:./envs/dev/main.tf", "git:v1:./envs/dev/modules/vars.tf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			includeHidden = tt.hidden
+			root, err := statArgument(tt.arg)
+			if err != nil {
+				t.Fatalf("statArgument() error = %v", err)
+			}
+			got := []string{}
+			for _, fileExtInfo := range getAllGitFiles(root) {
+				got = append(got, fileExtInfo.osPathname)
+			}
+			sort.Strings(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("getAllGitFiles() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("getAllGitFiles() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_compareFilesGit(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer setupGitRepo(t)()
+
+	original, _ := statArgument("git:v1:envs/dev/main.tf")
+	same, _ := statArgument("git:HEAD:envs/dev/main.tf")
+	desired, _ := statArgument("envs/dev/main.tf")
+
+	equal, err := compareFiles(original, same, false, true)
+	if err != nil || !equal {
+		t.Errorf("compareFiles() = %v, %v, want true", equal, err)
+	}
+
+	// Patching a git revision is skipped, the working tree is untouched
+	defer func(stats trackedStats) { runtimeStats = stats }(runtimeStats)
+	runtimeStats = trackedStats{}
+	setAnswers("y\ny\n")
+	equal, err = compareFiles(original, desired, false, false)
+	if err != nil || equal {
+		t.Errorf("compareFiles() = %v, %v, want false", equal, err)
+	}
+	if runtimeStats.PatchesApplied != 0 || runtimeStats.PatchesSkipped != 1 {
+		t.Errorf("compareFiles() Patched: %v, Skipped: %v, want 0, 1", runtimeStats.PatchesApplied, runtimeStats.PatchesSkipped)
+	}
+	content, _ := ioutil.ReadFile("envs/dev/main.tf")
+	if string(content) != "version = \"5.0.8\"\n" {
+		t.Errorf("compareFiles() changed the working tree: %q", content)
+	}
+}
+
+func Test_fileDirty(t *testing.T) {
+	defer setupGitRepo(t)()
+
+	writeTestFile("envs/dev/new.tf", "locals {}\n")
+	outside, err := ioutil.TempFile("", "outside")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(outside.Name())
+
+	tests := []struct {
+		name       string
+		osPathname string
+		want       bool
+	}{
+		{"Clean", "envs/dev/modules/vars.tf", false},
+		{"Modified", "envs/dev/main.tf", true},
+		{"Untracked", "envs/dev/new.tf", false},
+		{"OutsideRepository", outside.Name(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fileDirty(tt.osPathname); got != tt.want {
+				t.Errorf("fileDirty() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compareFilesDirtyAndStage(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer setupGitRepo(t)()
+	defer func() { allowDirty, gitStage = false, false }()
+	defer func(stats trackedStats) { runtimeStats = stats }(runtimeStats)
+
+	writeTestFile("desired/main.tf", "version = \"5.0.9\"\n")
+	writeTestFile("desired/vars.tf", "variable \"b\" {}\n")
+	writeTestFile("envs/dev/new.tf", "variable \"a\" {}\n")
+
+	tests := []struct {
+		name        string
+		original    string
+		desired     string
+		allowDirty  bool
+		gitStage    bool
+		wantPatched bool
+		wantDirty   int
+		wantStaged  bool
+	}{
+		{"Dirty", "envs/dev/main.tf", "desired/main.tf", false, false, false, 1, false},
+		{"AllowDirty", "envs/dev/main.tf", "desired/main.tf", true, true, true, 0, true},
+		{"Clean", "envs/dev/modules/vars.tf", "desired/vars.tf", false, false, true, 0, false},
+		{"Untracked", "envs/dev/new.tf", "desired/vars.tf", false, false, true, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAnswers("y\ny\ny\n")
+			runtimeStats = trackedStats{}
+
+			allowDirty, gitStage = tt.allowDirty, tt.gitStage
+			if _, err := compareFiles(loadTestFile(tt.original), loadTestFile(tt.desired), false, false); err != nil {
+				t.Errorf("compareFiles() error = %v", err)
+			}
+
+			original, _ := ioutil.ReadFile(tt.original)
+			desired, _ := ioutil.ReadFile(tt.desired)
+			if got := string(original) == string(desired); got != tt.wantPatched {
+				t.Errorf("compareFiles() patched = %v, want %v", got, tt.wantPatched)
+			}
+			if runtimeStats.FilesDirty != tt.wantDirty {
+				t.Errorf("compareFiles() Dirty: %v, want %v", runtimeStats.FilesDirty, tt.wantDirty)
+			}
+			staged, _ := gitCommand("diff", "--cached", "--name-only", "--", tt.original)
+			if got := len(staged) > 0; got != tt.wantStaged {
+				t.Errorf("compareFiles() staged = %v, want %v", got, tt.wantStaged)
+			}
+		})
+	}
+}
+
+func Test_loadDirtyFiles(t *testing.T) {
+	defer setupGitRepo(t)()
+	defer func() { dirtyTrees = nil }()
+
+	loadDirtyFiles(loadTestFile("envs/dev"))
+	dir, _ := filepath.Abs("envs/dev")
+	want := map[string]bool{filepath.Join(dir, "main.tf"): true}
+	if !reflect.DeepEqual(dirtyTrees[dir], want) {
+		t.Errorf("loadDirtyFiles() = %v, want %v", dirtyTrees[dir], want)
+	}
+
+	// Files below a loaded tree are not checked with git again
+	writeTestFile("envs/dev/modules/vars.tf", "variable \"c\" {}\n")
+	if fileDirty("envs/dev/modules/vars.tf") {
+		t.Errorf("fileDirty() = true, want the state when the tree was loaded")
+	}
+	if !fileDirty("envs/dev/main.tf") {
+		t.Errorf("fileDirty() = false, want true")
+	}
+}
+
+func Test_loadDirtyFilesSameDirectory(t *testing.T) {
+	defer setupGitRepo(t)()
+	defer func() { dirtyTrees = nil }()
+	defer func() { prompts = nil }()
+	defer func() { writeBoth = false }()
+
+	writeTestFile("envs/dev/other.tf", "version = \"5.0.6\"\n")
+	if _, err := gitCommand("add", "envs/dev/other.tf"); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile("envs/dev/other.tf", "version = \"5.0.9\"\n")
+
+	// Two files of one directory keep their own dirty state
+	loadDirtyFiles(loadTestFile("envs/dev/main.tf"))
+	loadDirtyFiles(loadTestFile("envs/dev/other.tf"))
+	if !fileDirty("envs/dev/main.tf") || !fileDirty("envs/dev/other.tf") {
+		t.Errorf("fileDirty() = %v, %v, want both dirty", fileDirty("envs/dev/main.tf"), fileDirty("envs/dev/other.tf"))
+	}
+	if fileDirty("envs/dev/modules/vars.tf") {
+		t.Errorf("fileDirty() = true for a clean file next to a loaded one")
+	}
+	dirtyTrees = nil
+
+	writeBoth = true
+	setAnswers("y\ny\n")
+	if got := program([]string{"--write-both", "envs/dev/main.tf", "envs/dev/other.tf"}); got != 0 {
+		t.Errorf("program() = %v, want 0", got)
+	}
+	content, _ := ioutil.ReadFile("envs/dev/main.tf")
+	if string(content) != "version = \"5.0.8\"\n" {
+		t.Errorf("program() patched a dirty file: %q", content)
+	}
+}
@@ -1,17 +1,27 @@
 module github.com/mgale/dap
 
-go 1.15
+go 1.18
 
 replace github.com/sergi/go-diff => github.com/mgale/go-diff v0.0.1-beta
 
 require (
 	github.com/DavidGamba/go-getoptions v0.23.0
 	github.com/gookit/color v1.3.8
+	github.com/hashicorp/hcl/v2 v2.16.2
 	github.com/karrick/godirwalk v1.16.1
+	github.com/sergi/go-diff v1.1.0
+	github.com/udhos/equalfile v0.3.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/agext/levenshtein v1.2.1 // indirect
+	github.com/apparentlymart/go-textseg/v13 v13.0.0 // indirect
 	github.com/kr/text v0.2.0 // indirect
+	github.com/mitchellh/go-wordwrap v0.0.0-20150314170334-ad45545899c7 // indirect
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
-	github.com/sergi/go-diff v1.1.0
 	github.com/stretchr/testify v1.7.0 // indirect
-	github.com/udhos/equalfile v0.3.0
+	github.com/zclconf/go-cty v1.12.1 // indirect
+	golang.org/x/text v0.13.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 )
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// hclGlobs are the files compared as Terraform HCL.
+var hclGlobs = []string{"*.tf", "*.tfvars"}
+
+// hclItem is an attribute or a block of a body.
+type hclItem struct {
+	key   string // attribute name, or block type and labels
+	attr  *hclsyntax.Attribute
+	block *hclsyntax.Block
+	start int
+	end   int
+}
+
+// hclItems returns the attributes and blocks of a body in the order they
+// are written. Repeated blocks such as ingress get their index in the key.
+func hclItems(body *hclsyntax.Body) []hclItem {
+	items := []hclItem{}
+	for _, attr := range body.Attributes {
+		items = append(items, hclItem{key: attr.Name, attr: attr, start: attr.SrcRange.Start.Byte, end: attr.SrcRange.End.Byte})
+	}
+	for _, block := range body.Blocks {
+		key := block.Type
+		for _, label := range block.Labels {
+			key += fmt.Sprintf(" %q", label)
+		}
+		items = append(items, hclItem{key: key, block: block, start: block.TypeRange.Start.Byte, end: block.CloseBraceRange.End.Byte})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].start < items[j].start })
+
+	seen := map[string]int{}
+	for i := range items {
+		key := items[i].key
+		if seen[key] > 0 {
+			items[i].key = fmt.Sprintf("%s[%d]", key, seen[key])
+		}
+		seen[key]++
+	}
+	return items
+}
+
+// hclItemIndex returns the index of the item with key, -1 when missing.
+func hclItemIndex(items []hclItem, key string) int {
+	for i, item := range items {
+		if item.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseHCL returns the body of a file, false when it does not parse.
+func parseHCL(text string) (*hclsyntax.Body, bool) {
+	file, diags := hclsyntax.ParseConfig([]byte(text), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		logDebug(fmt.Sprintf("Not comparing as HCL: %s", diags.Error()))
+		return nil, false
+	}
+	return file.Body.(*hclsyntax.Body), true
+}
+
+// equalHCLTokens compares two pieces of HCL token by token, so the
+// alignment and indentation terraform fmt changes are not differences.
+func equalHCLTokens(textA string, textB string) bool {
+	tokensA, _ := hclsyntax.LexConfig([]byte(textA), "", hcl.InitialPos)
+	tokensB, _ := hclsyntax.LexConfig([]byte(textB), "", hcl.InitialPos)
+	significant := func(tokens hclsyntax.Tokens) hclsyntax.Tokens {
+		kept := hclsyntax.Tokens{}
+		for _, token := range tokens {
+			if token.Type != hclsyntax.TokenNewline && token.Type != hclsyntax.TokenComment {
+				kept = append(kept, token)
+			}
+		}
+		return kept
+	}
+	tokensA, tokensB = significant(tokensA), significant(tokensB)
+	if len(tokensA) != len(tokensB) {
+		return false
+	}
+	for i := range tokensA {
+		if tokensA[i].Type != tokensB[i].Type || string(tokensA[i].Bytes) != string(tokensB[i].Bytes) {
+			return false
+		}
+	}
+	return true
+}
+
+// hclDiffer compares two HCL files.
+type hclDiffer struct {
+	textA string
+	textB string
+}
+
+// diffHCL returns the changes that turn the original into the desired
+// changes attribute by attribute, their paths are the enclosing blocks and
+// the attribute, module "redis" / node_type. It returns false when either
+// file does not parse.
+func diffHCL(textA string, textB string) ([]structChange, bool) {
+	a, okA := parseHCL(textA)
+	b, okB := parseHCL(textB)
+	if !okA || !okB {
+		return nil, false
+	}
+	d := hclDiffer{textA: textA, textB: textB}
+	return d.diffBody("", a, b)
+}
+
+func joinHCLPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + " / " + key
+}
+
+// lineSpan returns the lines holding text[start:end], through the end of
+// the last line. alone is false when other items share those lines.
+func lineSpan(text string, start int, end int) (int, int, bool) {
+	lineStart := strings.LastIndexByte(text[:start], '\n') + 1
+	lineEnd := len(text)
+	if i := strings.IndexByte(text[end:], '\n'); i != -1 {
+		lineEnd = end + i + 1
+	}
+	rest := strings.TrimSpace(text[end:lineEnd])
+	comment := strings.HasPrefix(rest, "#") || strings.HasPrefix(rest, "//")
+	alone := strings.TrimSpace(text[lineStart:start]) == "" && (rest == "" || comment)
+	return lineStart, lineEnd, alone
+}
+
+// reindent moves the lines after the first from the indentation from to to.
+func reindent(text string, from string, to string) string {
+	lines := splitLinesKeepEnds(text)
+	for i := 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], from) && strings.TrimSpace(lines[i]) != "" {
+			lines[i] = to + lines[i][len(from):]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// diffBody compares two bodies item by item. It returns false when the
+// changes can not be made inside the body, the caller then replaces it whole.
+func (d hclDiffer) diffBody(path string, a *hclsyntax.Body, b *hclsyntax.Body) ([]structChange, bool) {
+	itemsA, itemsB := hclItems(a), hclItems(b)
+	changes := []structChange{}
+	lastA := -1
+
+	for _, itemB := range itemsB {
+		itemPath := joinHCLPath(path, itemB.key)
+		iA := hclItemIndex(itemsA, itemB.key)
+		if iA == -1 {
+			change, ok := d.addItem(itemPath, itemsA, lastA, itemB)
+			if !ok {
+				return nil, false
+			}
+			changes = append(changes, change)
+			continue
+		}
+
+		lastA = iA
+		itemChanges, ok := d.diffItem(itemPath, itemsA[iA], itemB)
+		if !ok {
+			itemChanges = []structChange{d.replaceItem(itemPath, itemsA[iA], itemB)}
+		}
+		changes = append(changes, itemChanges...)
+	}
+
+	for _, itemA := range itemsA {
+		if hclItemIndex(itemsB, itemA.key) != -1 {
+			continue
+		}
+		start, end, alone := lineSpan(d.textA, itemA.start, itemA.end)
+		if !alone {
+			return nil, false
+		}
+		changes = append(changes, structChange{
+			kind:   keyRemoved,
+			path:   joinHCLPath(path, itemA.key),
+			before: d.itemValue(d.textA, itemA),
+			start:  start,
+			end:    end,
+		})
+	}
+
+	return changes, true
+}
+
+// diffItem returns the changes between two items with the same key.
+func (d hclDiffer) diffItem(path string, a hclItem, b hclItem) ([]structChange, bool) {
+	switch {
+	case a.block != nil && b.block != nil:
+		return d.diffBody(path, a.block.Body, b.block.Body)
+	case a.attr != nil && b.attr != nil:
+		rangeA, rangeB := a.attr.Expr.Range(), b.attr.Expr.Range()
+		exprA := d.textA[rangeA.Start.Byte:rangeA.End.Byte]
+		exprB := d.textB[rangeB.Start.Byte:rangeB.End.Byte]
+		if equalHCLTokens(exprA, exprB) {
+			return nil, true
+		}
+		return []structChange{{
+			kind:   keyChanged,
+			path:   path,
+			before: exprA,
+			after:  exprB,
+			start:  rangeA.Start.Byte,
+			end:    rangeA.End.Byte,
+			text:   reindent(exprB, lineIndent(d.textB, b.start), lineIndent(d.textA, a.start)),
+		}}, true
+	}
+	return nil, false
+}
+
+// itemValue returns the value of an attribute or a whole block, for review.
+func (d hclDiffer) itemValue(text string, item hclItem) string {
+	if item.attr != nil {
+		exprRange := item.attr.Expr.Range()
+		return text[exprRange.Start.Byte:exprRange.End.Byte]
+	}
+	return text[item.start:item.end]
+}
+
+// replaceItem replaces an item whole with the item from the desired changes.
+func (d hclDiffer) replaceItem(path string, a hclItem, b hclItem) structChange {
+	return structChange{
+		kind:   keyChanged,
+		path:   path,
+		before: d.itemValue(d.textA, a),
+		after:  d.itemValue(d.textB, b),
+		start:  a.start,
+		end:    a.end,
+		text:   reindent(d.textB[b.start:b.end], lineIndent(d.textB, b.start), lineIndent(d.textA, a.start)),
+	}
+}
+
+// addItem inserts an item from the desired changes after the item it
+// follows there, or before the first item when it comes first.
+func (d hclDiffer) addItem(path string, itemsA []hclItem, lastA int, b hclItem) (structChange, bool) {
+	if len(itemsA) == 0 {
+		return structChange{}, false
+	}
+	indent := lineIndent(d.textA, itemsA[0].start)
+	text := indent + reindent(d.textB[b.start:b.end], lineIndent(d.textB, b.start), indent) + "\n"
+
+	anchor := itemsA[0]
+	if lastA != -1 {
+		anchor = itemsA[lastA]
+	}
+	start, end, alone := lineSpan(d.textA, anchor.start, anchor.end)
+	if !alone {
+		return structChange{}, false
+	}
+	offset := start
+	if lastA != -1 {
+		offset = end
+		if !strings.HasSuffix(d.textA[:end], "\n") {
+			text = "\n" + strings.TrimSuffix(text, "\n")
+		}
+	}
+
+	return structChange{
+		kind:  keyAdded,
+		path:  path,
+		after: d.itemValue(d.textB, b),
+		start: offset,
+		end:   offset,
+		text:  text,
+	}, true
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_hclGlobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     bool
+	}{
+		{"Tf", "main.tf", true},
+		{"Tfvars", "prod.TFVARS", true},
+		{"TfJSON", "main.tf.json", false},
+		{"Text", "main.txt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchGlobs(hclGlobs, tt.fileName); got != tt.want {
+				t.Errorf("matchGlobs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diffHCL(t *testing.T) {
+	original := `module "redis" {
+  source    = "../../modules/redis"
+  node_type = "cache.t3.small" # sized for dev
+  tags      = local.common_tags
+}
+
+resource "aws_security_group" "redis" {
+  ingress {
+    from_port = 6379
+  }
+  ingress {
+    from_port = 6380
+  }
+}
+`
+
+	tests := []struct {
+		name      string
+		desired   string
+		wantOk    bool
+		wantPaths []string
+		want      string
+	}{
+		{
+			"Formatted",
+			"module \"redis\" {\n    source = \"../../modules/redis\"\n    node_type = \"cache.t3.small\"\n    tags = local.common_tags\n}\nresource \"aws_security_group\" \"redis\" {\n    ingress { \n        from_port = 6379\n    }\n    ingress {\n        from_port = 6380\n    }\n}\n",
+			true, []string{}, original,
+		},
+		{
+			"Attribute",
+			"module \"redis\" {\n  source = \"../../modules/redis\"\n  node_type = \"cache.t3.medium\"\n  tags = local.common_tags\n}\nresource \"aws_security_group\" \"redis\" {\n  ingress {\n    from_port = 6379\n  }\n  ingress {\n    from_port = 6381\n  }\n}\n",
+			true, []string{`module "redis" / node_type`, `resource "aws_security_group" "redis" / ingress[1] / from_port`},
+			`module "redis" {
+  source    = "../../modules/redis"
+  node_type = "cache.t3.medium" # sized for dev
+  tags      = local.common_tags
+}
+
+resource "aws_security_group" "redis" {
+  ingress {
+    from_port = 6379
+  }
+  ingress {
+    from_port = 6381
+  }
+}
+`,
+		},
+		{
+			"AddedAndRemoved",
+			"module \"redis\" {\n  source = \"../../modules/redis\"\n  engine_version = \"5.0.6\"\n  node_type = \"cache.t3.small\"\n}\nresource \"aws_security_group\" \"redis\" {\n  ingress {\n    from_port = 6379\n  }\n  ingress {\n    from_port = 6380\n  }\n}\noutput \"endpoint\" {\n  value = module.redis.endpoint\n}\n",
+			true, []string{`module "redis" / engine_version`, `module "redis" / tags`, `output "endpoint"`},
+			`module "redis" {
+  source    = "../../modules/redis"
+  engine_version = "5.0.6"
+  node_type = "cache.t3.small" # sized for dev
+}
+
+resource "aws_security_group" "redis" {
+  ingress {
+    from_port = 6379
+  }
+  ingress {
+    from_port = 6380
+  }
+}
+output "endpoint" {
+  value = module.redis.endpoint
+}
+`,
+		},
+		{
+			"Replaced",
+			"module \"redis\" {\n  source = \"../../modules/redis\"\n  node_type = \"cache.t3.small\"\n  tags {\n    team = \"data\"\n  }\n}\nresource \"aws_security_group\" \"redis\" {\n  ingress {\n    from_port = 6379\n  }\n  ingress {\n    from_port = 6380\n  }\n}\n",
+			true, []string{`module "redis" / tags`},
+			`module "redis" {
+  source    = "../../modules/redis"
+  node_type = "cache.t3.small" # sized for dev
+  tags {
+    team = "data"
+  }
+}
+
+resource "aws_security_group" "redis" {
+  ingress {
+    from_port = 6379
+  }
+  ingress {
+    from_port = 6380
+  }
+}
+`,
+		},
+		{"Invalid", "module \"redis\" {\n", false, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, ok := diffHCL(original, tt.desired)
+			if ok != tt.wantOk {
+				t.Fatalf("diffHCL() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			paths := []string{}
+			for _, change := range changes {
+				paths = append(paths, change.path)
+			}
+			if len(paths) != len(tt.wantPaths) {
+				t.Fatalf("diffHCL() paths = %q, want %q", paths, tt.wantPaths)
+			}
+			for i := range paths {
+				if paths[i] != tt.wantPaths[i] {
+					t.Errorf("diffHCL() paths = %q, want %q", paths, tt.wantPaths)
+				}
+			}
+			if got := applyStructChanges(original, changes); got != tt.want {
+				t.Errorf("applyStructChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ignoredKey(t *testing.T) {
+	defer func() { ignoreKeyRegexps = nil }()
+	ignoreKeyRegexps = compileKeyPatterns([]string{`module "redis" / tags`, "*/version", "spec.*"})
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"Exact", `module "redis" / tags`, true},
+		{"Other", `module "redis" / node_type`, false},
+		{"Prefix", "/scripts/version", true},
+		{"Literal", "spec_replicas", false},
+		{"Glob", "spec.replicas", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ignoredKey(tt.path); got != tt.want {
+				t.Errorf("ignoredKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compareFilesHCL(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer func() { ignoreKeyRegexps = nil }()
+
+	tmpDir, err := ioutil.TempDir("", "hcl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	original := writeTestFile(filepath.Join(tmpDir, "a/main.tf"), "module \"redis\" {\n  node_type  = \"cache.t3.small\"\n  build_tag  = \"dev\"\n}\n")
+	desired := writeTestFile(filepath.Join(tmpDir, "b/main.tf"), "module \"redis\" {\n  node_type = \"cache.t3.medium\"\n  build_tag = \"prod\"\n}\n")
+	ignoreKeyRegexps = compileKeyPatterns([]string{"*/ build_tag"})
+
+	// Review the file and take the only change left, node_type
+	setAnswers("y\ny\n")
+	equal, err := compareFiles(original, desired, false, false)
+	if err != nil || equal {
+		t.Errorf("compareFiles() = %v, %v, want false", equal, err)
+	}
+	content, _ := ioutil.ReadFile(original.osPathname)
+	if want := "module \"redis\" {\n  node_type  = \"cache.t3.medium\"\n  build_tag  = \"dev\"\n}\n"; string(content) != want {
+		t.Errorf("compareFiles() = %q, want %q", content, want)
+	}
+}
+
+func Test_compareFilesFormatOnly(t *testing.T) {
+	defer func() { prompts = nil }()
+	prompts = fixedPrompter{answer: "n"}
+
+	// Only the alignment written by terraform fmt differs
+	fileA := loadTestFile("testdata/whitespace/a.tf")
+	fileB := loadTestFile("testdata/whitespace/b.tf")
+
+	tests := []struct {
+		name       string
+		reportOnly bool
+	}{
+		{"ReportOnly", true},
+		{"Review", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := runtimeStats.FilesWDiff
+			equal, err := compareFiles(fileA, fileB, true, tt.reportOnly)
+			if err != nil || !equal {
+				t.Errorf("compareFiles() = %v, %v, want true", equal, err)
+			}
+			if got := runtimeStats.FilesWDiff - before; got != 0 {
+				t.Errorf("compareFiles() diffs = %v, want 0", got)
+			}
+		})
+	}
+}
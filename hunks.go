@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffHunk is a group of changes with their surrounding context lines,
+// it is the unit the user reviews and applies.
+type diffHunk struct {
+	diffs  []diffmatchpatch.Diff // changes with their context
+	first  int                   // index of the first change in the full diff list
+	last   int                   // index of the last change in the full diff list
+	startA int                   // first line in the original, zero based
+	startB int                   // first line in the desired changes, zero based
+	linesA int
+	linesB int
+
+	resolution hunkResolution // what the user picked for the hunk
+}
+
+// appendDiff adds diff to diffs, merging it into the last entry when the types match.
+func appendDiff(diffs []diffmatchpatch.Diff, diff diffmatchpatch.Diff) []diffmatchpatch.Diff {
+	if diff.Text == "" {
+		return diffs
+	}
+	if len(diffs) > 0 && diffs[len(diffs)-1].Type == diff.Type {
+		diffs[len(diffs)-1].Text += diff.Text
+		return diffs
+	}
+	return append(diffs, diff)
+}
+
+// groupHunks splits diffs into hunks with context lines around every change.
+// Changes separated by no more than 2*context unchanged lines share a hunk,
+// the same way diff -U merges hunks whose context overlaps.
+func groupHunks(diffs []diffmatchpatch.Diff, context int) []diffHunk {
+	hunks := []diffHunk{}
+	var hunk *diffHunk
+	lineA, lineB := 0, 0
+
+	closeHunk := func(trailing []string) {
+		text := strings.Join(trailing, "")
+		hunk.diffs = appendDiff(hunk.diffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffEqual, Text: text})
+		hunk.linesA += len(trailing)
+		hunk.linesB += len(trailing)
+		hunks = append(hunks, *hunk)
+		hunk = nil
+	}
+
+	for i, diff := range diffs {
+		lines := splitLinesKeepEnds(diff.Text)
+
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			if hunk != nil {
+				if len(lines) > 2*context || i+1 == len(diffs) {
+					closeHunk(lines[:minInt(context, len(lines))])
+				} else {
+					hunk.diffs = appendDiff(hunk.diffs, diff)
+					hunk.linesA += len(lines)
+					hunk.linesB += len(lines)
+				}
+			}
+			lineA += len(lines)
+			lineB += len(lines)
+			continue
+
+		case diffmatchpatch.DiffDelete:
+			if hunk == nil {
+				hunk = newHunk(diffs, i, context, lineA, lineB)
+			}
+			hunk.linesA += len(lines)
+			lineA += len(lines)
+
+		case diffmatchpatch.DiffInsert:
+			if hunk == nil {
+				hunk = newHunk(diffs, i, context, lineA, lineB)
+			}
+			hunk.linesB += len(lines)
+			lineB += len(lines)
+		}
+
+		hunk.diffs = appendDiff(hunk.diffs, diff)
+		hunk.last = i
+	}
+
+	if hunk != nil {
+		closeHunk(nil)
+	}
+
+	return hunks
+}
+
+// newHunk starts a hunk at the change diffs[index], with up to context
+// lines taken from the end of the preceding unchanged text.
+func newHunk(diffs []diffmatchpatch.Diff, index int, context int, lineA int, lineB int) *diffHunk {
+	hunk := &diffHunk{first: index, startA: lineA, startB: lineB}
+	if index > 0 && diffs[index-1].Type == diffmatchpatch.DiffEqual {
+		lines := splitLinesKeepEnds(diffs[index-1].Text)
+		leading := lines[len(lines)-minInt(context, len(lines)):]
+		hunk.diffs = appendDiff(hunk.diffs, diffmatchpatch.Diff{Type: diffmatchpatch.DiffEqual, Text: strings.Join(leading, "")})
+		hunk.startA -= len(leading)
+		hunk.startB -= len(leading)
+		hunk.linesA = len(leading)
+		hunk.linesB = len(leading)
+	}
+	return hunk
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// String returns the hunk in unified diff format.
+func (hunk diffHunk) String() string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "@@ -%s +%s @@\n", hunkRange(hunk.startA, hunk.linesA), hunkRange(hunk.startB, hunk.linesB))
+
+	for _, diff := range hunk.diffs {
+		prefix := " "
+		switch diff.Type {
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+		}
+		for _, line := range splitLinesKeepEnds(diff.Text) {
+			text.WriteString(prefix)
+			text.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				text.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+
+	return text.String()
+}
+
+// hunkRange formats the start and length of a hunk the way diff -u does.
+func hunkRange(start int, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
+
+// unifiedDiffs holds the differences found in this run when --patch is used.
+var unifiedDiffs strings.Builder
+
+// recordUnifiedDiff adds the line diff of two files to the --patch output,
+// with --context lines around each change.
+func recordUnifiedDiff(fileAExt fileInfoExtended, fileBExt fileInfoExtended) {
+	dmp := diffmatchpatch.New()
+	hunks := groupHunks(diffLineMode(dmp, fileAExt.fileContentString, fileBExt.fileContentString), diffContext)
+	if len(hunks) == 0 {
+		return
+	}
+	fmt.Fprintf(&unifiedDiffs, "--- %s\n+++ %s\n", fileAExt.osPathname, fileBExt.osPathname)
+	for _, hunk := range hunks {
+		unifiedDiffs.WriteString(hunk.String())
+	}
+}
+
+// writeUnifiedDiffs writes the differences found in this run to --patch.
+func writeUnifiedDiffs() error {
+	fmt.Printf("Writing patch: %s\n", unifiedPatchPath)
+	return ioutil.WriteFile(unifiedPatchPath, []byte(unifiedDiffs.String()), 0644)
+}
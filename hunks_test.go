@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func Test_groupHunks(t *testing.T) {
+	fileA := loadTestFile("testdata/smalldiff/t1.txt")
+	loadFileContent(&fileA)
+	fileB := loadTestFile("testdata/smalldiff/t2.txt")
+	loadFileContent(&fileB)
+
+	dmp := diffmatchpatch.New()
+	diffs := diffLineMode(dmp, fileA.fileContentString, fileB.fileContentString)
+
+	tests := []struct {
+		name      string
+		context   int
+		wantHunks int
+		wantFirst string
+	}{
+		{"NoContext", 0, 4, "@@ -2,2 +2,2 @@"},
+		{"OneLine", 1, 4, "@@ -1,4 +1,4 @@"},
+		{"ThreeLinesMerged", 3, 2, "@@ -1,16 +1,16 @@"},
+		{"Everything", 100, 1, "@@ -1,39 +1,39 @@"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := groupHunks(diffs, tt.context)
+			if len(got) != tt.wantHunks {
+				t.Errorf("groupHunks() = %v hunks, want %v", len(got), tt.wantHunks)
+				return
+			}
+			header := got[0].String()[:len(tt.wantFirst)]
+			if header != tt.wantFirst {
+				t.Errorf("groupHunks() first hunk = %v, want %v", header, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func Test_diffHunkString(t *testing.T) {
+	dmp := diffmatchpatch.New()
+	tests := []struct {
+		name  string
+		textA string
+		textB string
+		want  string
+	}{
+		{"Change", "a\nb\nc\n", "a\nx\nc\n", "@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"Insert", "a\n", "a\nb\n", "@@ -1 +1,2 @@\n a\n+b\n"},
+		{"Delete", "a\n", "", "@@ -1 +0,0 @@\n-a\n"},
+		{"NoNewline", "a\n", "a\nb", "@@ -1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks := groupHunks(diffLineMode(dmp, tt.textA, tt.textB), 1)
+			if len(hunks) != 1 {
+				t.Errorf("groupHunks() = %v hunks, want 1", len(hunks))
+				return
+			}
+			if got := hunks[0].String(); got != tt.want {
+				t.Errorf("diffHunk.String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_recordUnifiedDiff(t *testing.T) {
+	defer func() { diffContext = 1 }()
+	defer unifiedDiffs.Reset()
+
+	fileA := fileInfoExtended{osPathname: "a/main.tf", fileContentString: "a\nb\nc\nd\ne\n"}
+	fileB := fileInfoExtended{osPathname: "b/main.tf", fileContentString: "a\nb\nC\nd\ne\n"}
+
+	tests := []struct {
+		name    string
+		context int
+		want    string
+	}{
+		{"NoContext", 0, "--- a/main.tf\n+++ b/main.tf\n@@ -3 +3 @@\n-c\n+C\n"},
+		{"OneLine", 1, "--- a/main.tf\n+++ b/main.tf\n@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n"},
+		{"WholeFile", 3, "--- a/main.tf\n+++ b/main.tf\n@@ -1,5 +1,5 @@\n a\n b\n-c\n+C\n d\n e\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffContext = tt.context
+			unifiedDiffs.Reset()
+			recordUnifiedDiff(fileA, fileB)
+			if got := unifiedDiffs.String(); got != tt.want {
+				t.Errorf("recordUnifiedDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// iniGlobs are the files compared as INI or a systemd unit. Files such as
+// nginx.conf that turn out not to be INI fall back to the line diff.
+var iniGlobs = []string{
+	"*.ini", "*.conf", "*.cfg",
+	"*.service", "*.socket", "*.timer", "*.target", "*.path", "*.mount", "*.automount", "*.swap", "*.slice", "*.scope",
+	"*.network", "*.netdev", "*.link",
+}
+
+// iniKey is a key of a section, start and end span its whole lines.
+type iniKey struct {
+	key        string // name, with its index when repeated
+	value      string
+	start      int
+	end        int
+	valueStart int
+	valueEnd   int
+}
+
+// iniSection is a [Section] and its keys. The keys before the first section
+// header are in a section without a name. end is the end of the last key.
+type iniSection struct {
+	name      string
+	key       string // [name], with its index when repeated
+	start     int
+	headerEnd int
+	end       int
+	keys      []iniKey
+}
+
+// parseINI returns the sections of a file, false when a line is neither
+// a comment, a [Section] nor a key=value.
+func parseINI(text string) ([]iniSection, bool) {
+	sections := []iniSection{{}}
+	sectionSeen := map[string]int{}
+	keySeen := map[string]int{}
+	offset := 0
+	lines := splitLinesKeepEnds(text)
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		lineStart := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+		section := &sections[len(sections)-1]
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			name := trimmed[1 : len(trimmed)-1]
+			key := "[" + name + "]"
+			if sectionSeen[name] > 0 {
+				key = fmt.Sprintf("[%s][%d]", name, sectionSeen[name])
+			}
+			sectionSeen[name]++
+			keySeen = map[string]int{}
+			sections = append(sections, iniSection{name: name, key: key, start: lineStart, headerEnd: offset, end: offset})
+		case strings.Contains(trimmed, "="):
+			equals := strings.Index(line, "=")
+			name := strings.TrimSpace(line[:equals])
+			if name == "" {
+				return nil, false
+			}
+			// A value ending with a backslash goes on over the next line
+			for strings.HasSuffix(strings.TrimRight(line, "\r\n"), "\\") && i+1 < len(lines) {
+				i++
+				line += lines[i]
+				offset += len(lines[i])
+			}
+			valueStart := lineStart + equals + 1
+			valueStart += len(line[equals+1:]) - len(strings.TrimLeft(line[equals+1:], " \t"))
+			valueEnd := lineStart + len(strings.TrimRight(line, " \t\r\n"))
+			if valueEnd < valueStart {
+				valueEnd = valueStart
+			}
+
+			key := name
+			if keySeen[name] > 0 {
+				key = fmt.Sprintf("%s[%d]", name, keySeen[name])
+			}
+			keySeen[name]++
+			section.keys = append(section.keys, iniKey{key: key, value: text[valueStart:valueEnd], start: lineStart, end: offset, valueStart: valueStart, valueEnd: valueEnd})
+			section.end = offset
+		default:
+			return nil, false
+		}
+	}
+	return sections, true
+}
+
+func iniSectionIndex(sections []iniSection, key string) int {
+	for i, section := range sections {
+		if section.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func iniKeyIndex(keys []iniKey, key string) int {
+	for i, k := range keys {
+		if k.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// joinINIPath shows a key of a section the way it is reviewed, [Journal] Storage.
+func joinINIPath(section iniSection, key string) string {
+	if section.key == "" {
+		return key
+	}
+	return section.key + " " + key
+}
+
+// iniDiffer compares two INI files.
+type iniDiffer struct {
+	textA string
+	textB string
+}
+
+// diffINI returns the changes that turn the original into the desired
+// changes section by section and key by key. It returns false when either
+// file is not INI.
+func diffINI(textA string, textB string) ([]structChange, bool) {
+	sectionsA, okA := parseINI(textA)
+	sectionsB, okB := parseINI(textB)
+	if !okA || !okB {
+		logDebug("Not comparing as INI, a line is not a section, key or comment")
+		return nil, false
+	}
+	d := iniDiffer{textA: textA, textB: textB}
+
+	changes := []structChange{}
+	lastA := 0
+	for _, sectionB := range sectionsB {
+		iA := iniSectionIndex(sectionsA, sectionB.key)
+		if iA == -1 {
+			changes = append(changes, d.addSection(sectionsA, lastA, sectionB))
+			continue
+		}
+		lastA = iA
+		changes = append(changes, d.diffSection(sectionsA[iA], sectionB)...)
+	}
+
+	for _, sectionA := range sectionsA {
+		if iniSectionIndex(sectionsB, sectionA.key) != -1 {
+			continue
+		}
+		end := sectionA.end
+		for end < len(textA) && (textA[end] == '\n' || textA[end] == '\r') {
+			end++
+		}
+		changes = append(changes, structChange{
+			kind:   keyRemoved,
+			path:   sectionA.key,
+			before: strings.TrimRight(textA[sectionA.start:sectionA.end], "\n"),
+			start:  sectionA.start,
+			end:    end,
+		})
+	}
+	return changes, true
+}
+
+// diffSection compares the keys of a section.
+func (d iniDiffer) diffSection(a iniSection, b iniSection) []structChange {
+	changes := []structChange{}
+	lastA := -1
+
+	for _, keyB := range b.keys {
+		iA := iniKeyIndex(a.keys, keyB.key)
+		if iA == -1 {
+			// After the key it follows, or first in the section
+			offset := a.headerEnd
+			if lastA != -1 {
+				offset = a.keys[lastA].end
+			} else if len(a.keys) > 0 {
+				offset = a.keys[0].start
+			}
+			text := d.textB[keyB.start:keyB.end]
+			if !strings.HasSuffix(text, "\n") {
+				text += "\n"
+			}
+			if offset > 0 && d.textA[offset-1] != '\n' {
+				text = "\n" + strings.TrimSuffix(text, "\n")
+			}
+			changes = append(changes, structChange{kind: keyAdded, path: joinINIPath(a, keyB.key), after: keyB.value, start: offset, end: offset, text: text})
+			continue
+		}
+
+		lastA = iA
+		keyA := a.keys[iA]
+		if keyA.value == keyB.value {
+			continue
+		}
+		changes = append(changes, structChange{
+			kind:   keyChanged,
+			path:   joinINIPath(a, keyB.key),
+			before: keyA.value,
+			after:  keyB.value,
+			start:  keyA.valueStart,
+			end:    keyA.valueEnd,
+			text:   keyB.value,
+		})
+	}
+
+	for _, keyA := range a.keys {
+		if iniKeyIndex(b.keys, keyA.key) != -1 {
+			continue
+		}
+		changes = append(changes, structChange{kind: keyRemoved, path: joinINIPath(a, keyA.key), before: keyA.value, start: keyA.start, end: keyA.end})
+	}
+	return changes
+}
+
+// addSection inserts a section from the desired changes after the section
+// it follows there, separated by a blank line.
+func (d iniDiffer) addSection(sectionsA []iniSection, lastA int, b iniSection) structChange {
+	sectionText := strings.TrimRight(d.textB[b.start:b.end], "\n") + "\n"
+	change := structChange{kind: keyAdded, path: b.key, after: strings.TrimSuffix(sectionText, "\n")}
+
+	if lastA == 0 && sectionsA[0].end == 0 && len(sectionsA) > 1 {
+		// Before the first section when it comes first
+		change.start = sectionsA[lastA+1].start
+		change.text = sectionText + "\n"
+	} else {
+		change.start = sectionsA[lastA].end
+		if change.start > 0 && d.textA[change.start-1] != '\n' {
+			sectionText = "\n" + sectionText
+		}
+		if change.start > 0 {
+			sectionText = "\n" + sectionText
+		}
+		change.text = sectionText
+	}
+	change.end = change.start
+	return change
+}
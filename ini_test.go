@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_iniGlobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     bool
+	}{
+		{"Conf", "journald.conf", true},
+		{"Unit", "pulseaudio.service", true},
+		{"Ini", "php.INI", true},
+		{"Text", "notes.txt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchGlobs(iniGlobs, tt.fileName); got != tt.want {
+				t.Errorf("matchGlobs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diffINI(t *testing.T) {
+	original := `# Journal settings
+[Journal]
+Storage=auto
+#Compress=yes
+SystemMaxUse=1G
+
+[Service]
+ExecStart=
+ExecStart=/usr/bin/daemon \
+    --verbose
+`
+
+	tests := []struct {
+		name      string
+		desired   string
+		wantOk    bool
+		wantPaths []string
+		want      string
+	}{
+		{
+			"Reordered",
+			"[Service]\nExecStart =\nExecStart = /usr/bin/daemon \\\n    --verbose\n[Journal]\nSystemMaxUse=1G\nStorage=auto\n",
+			true, []string{}, original,
+		},
+		{
+			"Value",
+			"[Journal]\nStorage=persistent\nSystemMaxUse=1G\n\n[Service]\nExecStart=\nExecStart=/usr/bin/daemon --quiet\n",
+			true, []string{"[Journal] Storage", "[Service] ExecStart[1]"},
+			`# Journal settings
+[Journal]
+Storage=persistent
+#Compress=yes
+SystemMaxUse=1G
+
+[Service]
+ExecStart=
+ExecStart=/usr/bin/daemon --quiet
+`,
+		},
+		{
+			"AddedAndRemoved",
+			"[Journal]\nStorage=auto\nCompress=no\n\n[Install]\nWantedBy=multi-user.target\n\n[Service]\nExecStart=\nExecStart=/usr/bin/daemon \\\n    --verbose\n",
+			true, []string{"[Journal] Compress", "[Journal] SystemMaxUse", "[Install]"},
+			`# Journal settings
+[Journal]
+Storage=auto
+Compress=no
+#Compress=yes
+
+[Install]
+WantedBy=multi-user.target
+
+[Service]
+ExecStart=
+ExecStart=/usr/bin/daemon \
+    --verbose
+`,
+		},
+		{
+			"SectionRemoved",
+			"[Journal]\nStorage=auto\nSystemMaxUse=1G\n",
+			true, []string{"[Service]"},
+			`# Journal settings
+[Journal]
+Storage=auto
+#Compress=yes
+SystemMaxUse=1G
+
+`,
+		},
+		{"NotINI", "server {\n  listen 80;\n}\n", false, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, ok := diffINI(original, tt.desired)
+			if ok != tt.wantOk {
+				t.Fatalf("diffINI() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			paths := []string{}
+			for _, change := range changes {
+				paths = append(paths, change.path)
+			}
+			if len(paths) != len(tt.wantPaths) {
+				t.Fatalf("diffINI() paths = %q, want %q", paths, tt.wantPaths)
+			}
+			for i := range paths {
+				if paths[i] != tt.wantPaths[i] {
+					t.Errorf("diffINI() paths = %q, want %q", paths, tt.wantPaths)
+				}
+			}
+			if got := applyStructChanges(original, changes); got != tt.want {
+				t.Errorf("applyStructChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compareFilesINI(t *testing.T) {
+	defer func() { prompts = nil }()
+
+	tmpDir, err := ioutil.TempDir("", "ini")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	original := writeTestFile(filepath.Join(tmpDir, "a/journald.conf"), "[Journal]\n#Storage=auto\nStorage=auto\nSeal=yes\n")
+	desired := writeTestFile(filepath.Join(tmpDir, "b/journald.conf"), "[Journal]\nSeal=no\nStorage=persistent\n")
+
+	// Review the file, take the storage and skip the seal
+	setAnswers("y\nn\ny\n")
+	equal, err := compareFiles(original, desired, false, false)
+	if err != nil || equal {
+		t.Errorf("compareFiles() = %v, %v, want false", equal, err)
+	}
+	content, _ := ioutil.ReadFile(original.osPathname)
+	if want := "[Journal]\n#Storage=auto\nStorage=persistent\nSeal=yes\n"; string(content) != want {
+		t.Errorf("compareFiles() = %q, want %q", content, want)
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// jsonValue is a parsed JSON value with where it is written in the text.
+type jsonValue struct {
+	kind    byte // one of {["ntf or 0 for numbers
+	start   int
+	end     int
+	members []jsonMember
+	items   []*jsonValue
+}
+
+// jsonMember is a key of an object and its value.
+type jsonMember struct {
+	key      string
+	keyStart int
+	keyEnd   int
+	value    *jsonValue
+}
+
+// jsonGlobs are the files compared as JSON.
+var jsonGlobs = []string{"*.json"}
+
+// jsonParser reads the positions of values in a text already known to be valid JSON.
+type jsonParser struct {
+	text string
+	pos  int
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) != -1 {
+		p.pos++
+	}
+}
+
+func (p *jsonParser) value() *jsonValue {
+	p.skipSpace()
+	v := &jsonValue{kind: p.text[p.pos], start: p.pos}
+
+	switch v.kind {
+	case '{':
+		p.pos++
+		p.skipSpace()
+		for p.text[p.pos] != '}' {
+			member := jsonMember{keyStart: p.pos}
+			p.skipString()
+			member.keyEnd = p.pos
+			json.Unmarshal([]byte(p.text[member.keyStart:member.keyEnd]), &member.key)
+			p.skipSpace()
+			p.pos++ // :
+			member.value = p.value()
+			v.members = append(v.members, member)
+			p.skipSpace()
+			if p.text[p.pos] == ',' {
+				p.pos++
+				p.skipSpace()
+			}
+		}
+		p.pos++
+	case '[':
+		p.pos++
+		p.skipSpace()
+		for p.text[p.pos] != ']' {
+			v.items = append(v.items, p.value())
+			p.skipSpace()
+			if p.text[p.pos] == ',' {
+				p.pos++
+				p.skipSpace()
+			}
+		}
+		p.pos++
+	case '"':
+		p.skipString()
+	default:
+		if strings.IndexByte("ntf", v.kind) == -1 {
+			v.kind = 0
+		}
+		for p.pos < len(p.text) && strings.IndexByte(",]} \t\r\n", p.text[p.pos]) == -1 {
+			p.pos++
+		}
+	}
+
+	v.end = p.pos
+	return v
+}
+
+func (p *jsonParser) skipString() {
+	for p.pos++; p.text[p.pos] != '"'; p.pos++ {
+		if p.text[p.pos] == '\\' {
+			p.pos++
+		}
+	}
+	p.pos++
+}
+
+// parseJSON returns the value of a JSON document, false when the text is not valid JSON.
+func parseJSON(text string) (*jsonValue, bool) {
+	if !json.Valid([]byte(text)) {
+		return nil, false
+	}
+	p := &jsonParser{text: text}
+	return p.value(), true
+}
+
+// jsonPointer adds a key to an RFC 6901 JSON Pointer.
+func jsonPointer(path string, key string) string {
+	key = strings.ReplaceAll(key, "~", "~0")
+	return path + "/" + strings.ReplaceAll(key, "/", "~1")
+}
+
+// jsonDiffer compares two JSON documents.
+type jsonDiffer struct {
+	textA  string
+	textB  string
+	indent string // indentation step used by the original
+}
+
+// diffJSON returns the changes that turn the original into the desired
+// changes value by value, their paths are JSON Pointers. It returns false
+// when either file is not valid JSON.
+func diffJSON(textA string, textB string) ([]structChange, bool) {
+	a, okA := parseJSON(textA)
+	b, okB := parseJSON(textB)
+	if !okA || !okB {
+		logDebug("Not comparing as JSON, invalid document")
+		return nil, false
+	}
+	d := jsonDiffer{textA: textA, textB: textB, indent: jsonIndentStep(textA)}
+	changes := d.diffValue("", a, b)
+	if len(changes) == 1 && changes[0].path == "" {
+		logDebug("Not comparing as JSON, the whole document is replaced")
+		return nil, false
+	}
+	return changes, true
+}
+
+// jsonIndentStep returns the indentation of the first indented line, two spaces when there is none.
+func jsonIndentStep(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && trimmed != line {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+// equalJSON compares two values, ignoring formatting and key order.
+func (d jsonDiffer) equalJSON(a *jsonValue, b *jsonValue) bool {
+	if a.kind != b.kind {
+		return false
+	}
+	textA, textB := d.textA[a.start:a.end], d.textB[b.start:b.end]
+	switch a.kind {
+	case '{':
+		if len(a.members) != len(b.members) {
+			return false
+		}
+		for _, member := range a.members {
+			other := jsonMemberIndex(b, member.key)
+			if other == -1 || !d.equalJSON(member.value, b.members[other].value) {
+				return false
+			}
+		}
+		return true
+	case '[':
+		if len(a.items) != len(b.items) {
+			return false
+		}
+		for i := range a.items {
+			if !d.equalJSON(a.items[i], b.items[i]) {
+				return false
+			}
+		}
+		return true
+	case '"':
+		var stringA, stringB string
+		json.Unmarshal([]byte(textA), &stringA)
+		json.Unmarshal([]byte(textB), &stringB)
+		return stringA == stringB
+	case 0:
+		numberA, errA := strconv.ParseFloat(textA, 64)
+		numberB, errB := strconv.ParseFloat(textB, 64)
+		if errA == nil && errB == nil {
+			return numberA == numberB
+		}
+	}
+	return textA == textB
+}
+
+// jsonMemberIndex returns the index of a key in an object, -1 when missing.
+func jsonMemberIndex(object *jsonValue, key string) int {
+	for i, member := range object.members {
+		if member.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// render returns a value from the desired changes to be written at offset in the original.
+// Values spread over several lines are indented the way the original is.
+func (d jsonDiffer) render(b *jsonValue, offset int, multiline bool) string {
+	raw := d.textB[b.start:b.end]
+	if !strings.Contains(raw, "\n") && !multiline {
+		return raw
+	}
+	var compact, out bytes.Buffer
+	json.Compact(&compact, []byte(raw))
+	if !multiline {
+		return compact.String()
+	}
+	json.Indent(&out, compact.Bytes(), lineIndent(d.textA, offset), d.indent)
+	return out.String()
+}
+
+// diffValue returns the changes between two values at path.
+func (d jsonDiffer) diffValue(path string, a *jsonValue, b *jsonValue) []structChange {
+	if d.equalJSON(a, b) {
+		return nil
+	}
+
+	switch {
+	case a.kind == '{' && b.kind == '{' && len(a.members) > 0 && len(b.members) > 0:
+		return d.diffObject(path, a, b)
+	case a.kind == '[' && b.kind == '[' && len(a.items) == len(b.items):
+		changes := []structChange{}
+		for i := range a.items {
+			changes = append(changes, d.diffValue(fmt.Sprintf("%s/%d", path, i), a.items[i], b.items[i])...)
+		}
+		return changes
+	}
+
+	multiline := strings.Contains(d.textA[a.start:a.end], "\n")
+	if a.kind != '{' && a.kind != '[' {
+		multiline = strings.Contains(strings.TrimSpace(d.textA), "\n")
+	}
+	return []structChange{{
+		kind:   keyChanged,
+		path:   path,
+		before: d.textA[a.start:a.end],
+		after:  d.textB[b.start:b.end],
+		start:  a.start,
+		end:    a.end,
+		text:   d.render(b, a.start, multiline),
+	}}
+}
+
+// diffObject compares two objects key by key. Added keys go after the key
+// they follow in the desired changes, with the spacing of the original.
+func (d jsonDiffer) diffObject(path string, a *jsonValue, b *jsonValue) []structChange {
+	changes := []structChange{}
+	lastA := -1
+
+	for _, memberB := range b.members {
+		keyPath := jsonPointer(path, memberB.key)
+		iA := jsonMemberIndex(a, memberB.key)
+		if iA != -1 {
+			lastA = iA
+			changes = append(changes, d.diffValue(keyPath, a.members[iA].value, memberB.value)...)
+			continue
+		}
+
+		// Spacing before a key and between the key and its value
+		anchor := a.members[0]
+		if lastA != -1 {
+			anchor = a.members[lastA]
+		}
+		lead := d.textA[a.start+1 : a.members[0].keyStart]
+		if lastA > 0 {
+			lead = d.textA[a.members[lastA-1].value.end:anchor.keyStart]
+			lead = lead[strings.IndexByte(lead, ',')+1:]
+		}
+		separator := d.textA[anchor.keyEnd:anchor.value.start]
+		multiline := strings.Contains(lead, "\n")
+		member := d.textB[memberB.keyStart:memberB.keyEnd] + separator + d.render(memberB.value, anchor.keyStart, multiline)
+
+		change := structChange{kind: keyAdded, path: keyPath, after: d.textB[memberB.value.start:memberB.value.end]}
+		if lastA == -1 {
+			change.start, change.end, change.text = anchor.keyStart, anchor.keyStart, member+","+lead
+		} else {
+			change.start, change.end, change.text = anchor.value.end, anchor.value.end, ","+lead+member
+		}
+		changes = append(changes, change)
+	}
+
+	for i, memberA := range a.members {
+		if jsonMemberIndex(b, memberA.key) != -1 {
+			continue
+		}
+		// The comma left behind by the last key is removed by tidyJSONCommas
+		end := memberA.value.end
+		if i+1 < len(a.members) {
+			end = a.members[i+1].keyStart
+		}
+		changes = append(changes, structChange{
+			kind:   keyRemoved,
+			path:   jsonPointer(path, memberA.key),
+			before: d.textA[memberA.value.start:memberA.value.end],
+			start:  memberA.keyStart,
+			end:    end,
+		})
+	}
+
+	return changes
+}
+
+// tidyJSONCommas removes the comma and blank space left behind once the last
+// key of an object is removed, keeping the line break before the bracket.
+func tidyJSONCommas(text string) string {
+	out := strings.Builder{}
+	inString := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inString && c == '\\':
+			out.WriteByte(c)
+			i++
+			c = text[i]
+		case c == '"':
+			inString = !inString
+		case !inString && c == ',':
+			next := i + 1
+			for next < len(text) && strings.IndexByte(" \t\r\n", text[next]) != -1 {
+				next++
+			}
+			if next < len(text) && (text[next] == '}' || text[next] == ']') {
+				if lineBreak := strings.LastIndexByte(text[i:next], '\n'); lineBreak != -1 {
+					out.WriteString(text[i+lineBreak : next])
+				}
+				i = next - 1
+				continue
+			}
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
+
+// jsonPatchOperation is one operation of an RFC 6902 JSON Patch.
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// jsonPatchFile holds the operations accepted for one file.
+type jsonPatchFile struct {
+	osPathname string
+	operations []jsonPatchOperation
+}
+
+var jsonPatches []jsonPatchFile
+
+// recordJSONPatch keeps the changes accepted for a file when --json-patch is used.
+func recordJSONPatch(fileName string, accepted []structChange) {
+	if jsonPatchPath == "" {
+		return
+	}
+	operations := []jsonPatchOperation{}
+	for _, change := range accepted {
+		operation := jsonPatchOperation{Op: "replace", Path: change.path}
+		switch change.kind {
+		case keyAdded:
+			operation.Op = "add"
+		case keyRemoved:
+			operation.Op = "remove"
+		}
+		if change.kind != keyRemoved {
+			var value bytes.Buffer
+			json.Compact(&value, []byte(change.after))
+			operation.Value = value.Bytes()
+		}
+		operations = append(operations, operation)
+	}
+	jsonPatches = append(jsonPatches, jsonPatchFile{osPathname: fileName, operations: operations})
+}
+
+// recordJSONDocument keeps a JSON file patched without the JSON comparator,
+// line by line for example, as one operation replacing the whole document.
+func recordJSONDocument(fileName string, content []byte) {
+	var value bytes.Buffer
+	if err := json.Compact(&value, content); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not valid JSON once patched, it is left out of the JSON Patch\n", fileName)
+		return
+	}
+	operation := jsonPatchOperation{Op: "replace", Path: "", Value: value.Bytes()}
+	jsonPatches = append(jsonPatches, jsonPatchFile{osPathname: fileName, operations: []jsonPatchOperation{operation}})
+}
+
+// writeJSONPatches writes the accepted changes as JSON Patch documents.
+// Comparing two files writes one document to --json-patch, comparing
+// directories writes one per patched file below it.
+func writeJSONPatches(pathAExt fileInfoExtended, pathBExt fileInfoExtended) error {
+	if !pathAExt.fileInfo.IsDir() || !pathBExt.fileInfo.IsDir() {
+		operations := []jsonPatchOperation{}
+		for _, patch := range jsonPatches {
+			operations = append(operations, patch.operations...)
+		}
+		return writeJSONPatch(jsonPatchPath, operations)
+	}
+
+	for _, patch := range jsonPatches {
+		if len(patch.operations) == 0 {
+			continue
+		}
+		key := patch.osPathname
+		for _, root := range []string{pathAExt.osPathname, pathBExt.osPathname} {
+			root = filepath.Clean(root)
+			if strings.HasPrefix(patch.osPathname, root+string(filepath.Separator)) {
+				key = fileKeyOf(patch.osPathname, root)
+				break
+			}
+		}
+		fileName := filepath.Join(jsonPatchPath, strings.TrimSuffix(key, filepath.Ext(key))+".patch.json")
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			return err
+		}
+		if err := writeJSONPatch(fileName, patch.operations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSONPatch(fileName string, operations []jsonPatchOperation) error {
+	content, err := json.MarshalIndent(operations, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Writing JSON Patch: %s\n", fileName)
+	return ioutil.WriteFile(fileName, append(content, '\n'), 0644)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DavidGamba/go-getoptions"
+)
+
+func Test_jsonGlobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     bool
+	}{
+		{"Json", "package.json", true},
+		{"Upper", "tsconfig.JSON", true},
+		{"Yaml", "values.yaml", false},
+		{"NoExt", "json", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchGlobs(jsonGlobs, tt.fileName); got != tt.want {
+				t.Errorf("matchGlobs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_jsonPointer(t *testing.T) {
+	if got := jsonPointer("/paths", "a/b~c"); got != "/paths/a~1b~0c" {
+		t.Errorf("jsonPointer() = %v, want /paths/a~1b~0c", got)
+	}
+}
+
+func Test_diffJSON(t *testing.T) {
+	original := `{
+    "name": "web",
+    "version": "1.0.0",
+    "scripts": {
+        "build": "make",
+        "test": "make test"
+    },
+    "ports": [80, 443],
+    "private": true
+}
+`
+
+	tests := []struct {
+		name      string
+		desired   string
+		wantOk    bool
+		wantPaths []string
+		want      string
+	}{
+		{
+			"Reordered",
+			`{"private": true, "ports": [80, 443.0], "scripts": {"test": "make test", "build": "make"}, "version": "1.0.0", "name": "web"}`,
+			true, []string{}, original,
+		},
+		{
+			"Scalar",
+			`{"name": "web", "version": "1.1.0", "scripts": {"build": "make", "test": "make check"}, "ports": [80, 8443], "private": true}`,
+			true, []string{"/version", "/scripts/test", "/ports/1"},
+			`{
+    "name": "web",
+    "version": "1.1.0",
+    "scripts": {
+        "build": "make",
+        "test": "make check"
+    },
+    "ports": [80, 8443],
+    "private": true
+}
+`,
+		},
+		{
+			"AddedAndRemoved",
+			`{"license": "MIT", "name": "web", "version": "1.0.0", "main": "index.js", "scripts": {"lint": "make lint"}, "ports": [80, 443]}`,
+			true, []string{"/license", "/main", "/scripts/lint", "/scripts/build", "/scripts/test", "/private"},
+			`{
+    "license": "MIT",
+    "name": "web",
+    "version": "1.0.0",
+    "main": "index.js",
+    "scripts": {
+        "lint": "make lint"
+    },
+    "ports": [80, 443]
+}
+`,
+		},
+		{
+			"Replaced",
+			`{"name": "web", "version": "1.0.0", "scripts": {"build": "make", "test": "make test"}, "ports": [80], "private": {"registry": "local"}}`,
+			true, []string{"/ports", "/private"},
+			`{
+    "name": "web",
+    "version": "1.0.0",
+    "scripts": {
+        "build": "make",
+        "test": "make test"
+    },
+    "ports": [80],
+    "private": {
+        "registry": "local"
+    }
+}
+`,
+		},
+		{"Invalid", `{"name": }`, false, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, ok := diffJSON(original, tt.desired)
+			if ok != tt.wantOk {
+				t.Fatalf("diffJSON() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			paths := []string{}
+			for _, change := range changes {
+				paths = append(paths, change.path)
+			}
+			if len(paths) != len(tt.wantPaths) {
+				t.Fatalf("diffJSON() paths = %v, want %v", paths, tt.wantPaths)
+			}
+			for i := range paths {
+				if paths[i] != tt.wantPaths[i] {
+					t.Errorf("diffJSON() paths = %v, want %v", paths, tt.wantPaths)
+				}
+			}
+			if got := tidyJSONCommas(applyStructChanges(original, changes)); got != tt.want {
+				t.Errorf("applyStructChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_tidyJSONCommas(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"Inline", `{"a": 1, }`, `{"a": 1}`},
+		{"Lines", "{\n  \"a\": 1,\n  \n}", "{\n  \"a\": 1\n}"},
+		{"Array", `[1, ]`, `[1]`},
+		{"InString", `{"a": ", }"}`, `{"a": ", }"}`},
+		{"Escaped", `{"a": "\", }"}`, `{"a": "\", }"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tidyJSONCommas(tt.text); got != tt.want {
+				t.Errorf("tidyJSONCommas() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compareFilesJSON(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer func() { jsonPatchPath, jsonPatches = "", nil }()
+
+	tmpDir, err := ioutil.TempDir("", "json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	original := writeTestFile(filepath.Join(tmpDir, "a/config.json"), "{\n\t\"replicas\": 2,\n\t\"image\": \"web:1.0\",\n\t\"debug\": true\n}\n")
+	desired := writeTestFile(filepath.Join(tmpDir, "b/config.json"), `{"image": "web:1.1", "replicas": 3, "labels": {"app": "web"}}`)
+	jsonPatchPath = filepath.Join(tmpDir, "config.patch.json")
+
+	// Review the file, skip the replicas and take everything else
+	setAnswers("y\ny\nn\ny\ny\n")
+	equal, err := compareFiles(original, desired, false, false)
+	if err != nil || equal {
+		t.Errorf("compareFiles() = %v, %v, want false", equal, err)
+	}
+	content, _ := ioutil.ReadFile(original.osPathname)
+	if want := "{\n\t\"replicas\": 2,\n\t\"labels\": {\n\t\t\"app\": \"web\"\n\t},\n\t\"image\": \"web:1.1\"\n}\n"; string(content) != want {
+		t.Errorf("compareFiles() = %q, want %q", content, want)
+	}
+
+	if err := writeJSONPatches(original, desired); err != nil {
+		t.Fatalf("writeJSONPatches() error = %v", err)
+	}
+	patch, _ := ioutil.ReadFile(jsonPatchPath)
+	want := `[
+  {
+    "op": "replace",
+    "path": "/image",
+    "value": "web:1.1"
+  },
+  {
+    "op": "add",
+    "path": "/labels",
+    "value": {
+      "app": "web"
+    }
+  },
+  {
+    "op": "remove",
+    "path": "/debug"
+  }
+]
+`
+	if string(patch) != want {
+		t.Errorf("writeJSONPatches() = %s, want %s", patch, want)
+	}
+}
+
+func Test_writeJSONPatchesDirectories(t *testing.T) {
+	defer func() { jsonPatchPath, jsonPatches = "", nil }()
+
+	tmpDir, err := ioutil.TempDir("", "json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	rootA := writeTestFile(filepath.Join(tmpDir, "a/.keep"), "")
+	rootB := writeTestFile(filepath.Join(tmpDir, "b/.keep"), "")
+	rootA, _ = statArgument(filepath.Dir(rootA.osPathname))
+	rootB, _ = statArgument(filepath.Dir(rootB.osPathname))
+	jsonPatchPath = filepath.Join(tmpDir, "patches")
+
+	// Patched with --reverse, so the patched file is below <desired_changes>
+	recordJSONPatch(filepath.Join(tmpDir, "b/app/config.json"), []structChange{{kind: keyChanged, path: "/port", after: "8080"}})
+	recordJSONPatch(filepath.Join(tmpDir, "a/untouched.json"), nil)
+
+	if err := writeJSONPatches(rootA, rootB); err != nil {
+		t.Fatalf("writeJSONPatches() error = %v", err)
+	}
+	patch, err := ioutil.ReadFile(filepath.Join(jsonPatchPath, "app/config.patch.json"))
+	if err != nil || !strings.Contains(string(patch), `"value": 8080`) {
+		t.Errorf("writeJSONPatches() = %s, %v", patch, err)
+	}
+	if _, err := os.Stat(filepath.Join(jsonPatchPath, "untouched.patch.json")); !os.IsNotExist(err) {
+		t.Errorf("writeJSONPatches() wrote a patch without operations")
+	}
+}
+
+func Test_mainWorkJSONPatch(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer func() { jsonPatchPath, jsonPatches = "", nil }()
+	prompts = fixedPrompter{answer: "y"}
+
+	tmpDir, err := ioutil.TempDir("", "json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	optTest := getoptions.New()
+	optTest.Bool("dry-run", true)
+
+	tests := []struct {
+		name     string
+		original string
+		desired  string
+		want     string
+	}{
+		{"ByValue", `{"port": 80}`, `{"port": 8080}`, `[{"op":"replace","path":"/port","value":8080}]`},
+		// Not valid JSON, compared line by line
+		{"ByLine", "{\"port\": 80,}\n", "{\"port\": 8080}\n", `[{"op":"replace","path":"","value":{"port":8080}}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := writeTestFile(filepath.Join(tmpDir, tt.name, "a/config.json"), tt.original)
+			desired := writeTestFile(filepath.Join(tmpDir, tt.name, "b/config.json"), tt.desired)
+			jsonPatchPath = filepath.Join(tmpDir, tt.name, "config.patch.json")
+			if got := mainWork(optTest, original, desired); got != 0 {
+				t.Fatalf("mainWork() = %v, want 0", got)
+			}
+			patch, _ := ioutil.ReadFile(jsonPatchPath)
+			var compact bytes.Buffer
+			json.Compact(&compact, patch)
+			if compact.String() != tt.want {
+				t.Errorf("mainWork() patch = %s, want %s", compact.String(), tt.want)
+			}
+		})
+	}
+}
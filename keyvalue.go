@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keyValueSyntax describes a file of keys without sections, such as .env.
+type keyValueSyntax struct {
+	comments string // characters that start a comment line
+	// split returns the key of a line and where its value starts, false when the line is not a key
+	split func(line string) (string, int, bool)
+	// continued reports if a value goes on over the next line
+	continued func(value string) bool
+}
+
+var dotenvSyntax = keyValueSyntax{comments: "#", split: splitDotenvLine, continued: dotenvContinued}
+var propertiesSyntax = keyValueSyntax{comments: "#!", split: splitPropertiesLine, continued: propertiesContinued}
+
+// dotenvGlobs are the files compared as dotenv, .env, .env.local or prod.env for example.
+var dotenvGlobs = []string{".env", ".env.*", "*.env"}
+
+// propertiesGlobs are the files compared as Java properties.
+var propertiesGlobs = []string{"*.properties"}
+
+// splitDotenvLine reads KEY=value, optionally written as export KEY=value.
+func splitDotenvLine(line string) (string, int, bool) {
+	equals := strings.Index(line, "=")
+	if equals == -1 {
+		return "", 0, false
+	}
+	key := strings.TrimSpace(line[:equals])
+	key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+	if key == "" || strings.ContainsAny(key, " \t") {
+		return "", 0, false
+	}
+	return key, equals + 1, true
+}
+
+// dotenvContinued reports if a quoted value is not closed on its line. The
+// closing quote may be followed by a comment, in double quotes a backslash
+// escapes the next character.
+func dotenvContinued(value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		return false
+	}
+	for i := 1; i < len(value); i++ {
+		switch {
+		case value[i] == value[0]:
+			return false
+		case value[i] == '\\' && value[0] == '"':
+			i++
+		}
+	}
+	return true
+}
+
+// splitPropertiesLine reads key=value, key: value or key value, the key
+// ends at the first separator that is not escaped.
+func splitPropertiesLine(line string) (string, int, bool) {
+	start := len(line) - len(strings.TrimLeft(line, " \t\f"))
+	end := start
+	for end < len(line) && strings.IndexByte("=: \t\f\r\n", line[end]) == -1 {
+		if line[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+	valueAt := end
+	for valueAt < len(line) && strings.IndexByte(" \t\f", line[valueAt]) != -1 {
+		valueAt++
+	}
+	if valueAt < len(line) && (line[valueAt] == '=' || line[valueAt] == ':') {
+		valueAt++
+	}
+	return line[start:end], valueAt, end > start
+}
+
+// propertiesContinued reports if a line ends with an odd number of backslashes.
+func propertiesContinued(value string) bool {
+	value = strings.TrimRight(value, "\r\n")
+	return (len(value)-len(strings.TrimRight(value, "\\")))%2 == 1
+}
+
+// parseKeyValues returns the keys of a file, false when a line is neither
+// a comment nor a key. Repeated keys get their index in the key.
+func parseKeyValues(text string, syntax keyValueSyntax) ([]iniKey, bool) {
+	keys := []iniKey{}
+	seen := map[string]int{}
+	offset := 0
+	lines := splitLinesKeepEnds(text)
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		lineStart := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.IndexByte(syntax.comments, trimmed[0]) != -1 {
+			continue
+		}
+
+		name, valueAt, ok := syntax.split(line)
+		if !ok {
+			return nil, false
+		}
+		for syntax.continued(line[valueAt:]) && i+1 < len(lines) {
+			i++
+			line += lines[i]
+			offset += len(lines[i])
+		}
+		valueStart := lineStart + valueAt + len(line[valueAt:]) - len(strings.TrimLeft(line[valueAt:], " \t\f"))
+		valueEnd := lineStart + len(strings.TrimRight(line, " \t\f\r\n"))
+		if valueEnd < valueStart {
+			valueEnd = valueStart
+		}
+
+		key := name
+		if seen[name] > 0 {
+			key = fmt.Sprintf("%s[%d]", name, seen[name])
+		}
+		seen[name]++
+		keys = append(keys, iniKey{key: key, value: text[valueStart:valueEnd], start: lineStart, end: offset, valueStart: valueStart, valueEnd: valueEnd})
+	}
+	return keys, true
+}
+
+// diffKeyValues returns the diff of a structFormat for files of keys
+// without sections, they are compared like a single INI section.
+func diffKeyValues(syntax keyValueSyntax) func(textA string, textB string) ([]structChange, bool) {
+	return func(textA string, textB string) ([]structChange, bool) {
+		keysA, okA := parseKeyValues(textA, syntax)
+		keysB, okB := parseKeyValues(textB, syntax)
+		if !okA || !okB {
+			logDebug("Not comparing by key, a line is not a key or comment")
+			return nil, false
+		}
+		d := iniDiffer{textA: textA, textB: textB}
+		return d.diffSection(iniSection{keys: keysA}, iniSection{keys: keysB}), true
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_dotenvGlobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     bool
+	}{
+		{"Env", "app/.env", true},
+		{"Local", ".env.local", true},
+		{"Suffix", "prod.env", true},
+		{"Environment", "environment.txt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchGlobs(dotenvGlobs, tt.fileName); got != tt.want {
+				t.Errorf("matchGlobs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dotenvContinued(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"Plain", "bar\n", false},
+		{"Quoted", "\"bar\"\n", false},
+		{"Comment", "\"bar\" # note\n", false},
+		{"SingleComment", "'bar' # note\n", false},
+		{"Open", "\"-----BEGIN\n", true},
+		{"OnlyQuote", "\"\n", true},
+		{"EscapedQuote", "\"say \\\"hi\\\"\n", true},
+		{"EscapedThenClosed", "\"say \\\"hi\\\"\" # note\n", false},
+		{"SingleNoEscape", "'C:\\' # dir\n", false},
+		{"ClosedOnNextLine", "\"-----BEGIN\nxyz\n-----END\"\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dotenvContinued(tt.value); got != tt.want {
+				t.Errorf("dotenvContinued(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	// A comment after the closing quote does not swallow the next keys
+	keys, ok := parseKeyValues("FOO=\"bar\" # note\nBAR=1\n", dotenvSyntax)
+	if !ok || len(keys) != 2 || keys[1].key != "BAR" {
+		t.Errorf("parseKeyValues() = %v, %v, want FOO and BAR", keys, ok)
+	}
+}
+
+func Test_parseKeyValuesProperties(t *testing.T) {
+	text := "# settings\n! old style comment\nhost = db\nport:5432\nname  web\npath=a\\\n  b\nescaped\\=key=1\n"
+	keys, ok := parseKeyValues(text, propertiesSyntax)
+	if !ok {
+		t.Fatalf("parseKeyValues() ok = false")
+	}
+	want := []struct{ key, value string }{
+		{"host", "db"}, {"port", "5432"}, {"name", "web"}, {"path", "a\\\n  b"}, {"escaped\\=key", "1"},
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("parseKeyValues() = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i].key != want[i].key || keys[i].value != want[i].value {
+			t.Errorf("parseKeyValues() key %d = %q: %q, want %q: %q", i, keys[i].key, keys[i].value, want[i].key, want[i].value)
+		}
+	}
+}
+
+func Test_diffDotenv(t *testing.T) {
+	original := `# Database
+DB_HOST=localhost
+DB_PORT=5432
+export API_KEY="abc"
+CERT="-----BEGIN
+xyz
+-----END"
+`
+
+	tests := []struct {
+		name      string
+		desired   string
+		wantOk    bool
+		wantPaths []string
+		want      string
+	}{
+		{
+			"Reordered",
+			"API_KEY=\"abc\"\nDB_PORT=5432\nCERT=\"-----BEGIN\nxyz\n-----END\"\nDB_HOST=localhost\n",
+			true, []string{}, original,
+		},
+		{
+			"ChangedAddedRemoved",
+			"DEBUG=1\nDB_HOST=db.internal\nDB_PORT=5432\nDB_NAME=app\nCERT=\"-----BEGIN\nxyz\n-----END\"\n",
+			true, []string{"DEBUG", "DB_HOST", "DB_NAME", "API_KEY"},
+			`# Database
+DEBUG=1
+DB_HOST=db.internal
+DB_PORT=5432
+DB_NAME=app
+CERT="-----BEGIN
+xyz
+-----END"
+`,
+		},
+		{"NotDotenv", "DB_HOST localhost\n", false, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, ok := diffKeyValues(dotenvSyntax)(original, tt.desired)
+			if ok != tt.wantOk {
+				t.Fatalf("diffKeyValues() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			paths := []string{}
+			for _, change := range changes {
+				paths = append(paths, change.path)
+			}
+			if len(paths) != len(tt.wantPaths) {
+				t.Fatalf("diffKeyValues() paths = %q, want %q", paths, tt.wantPaths)
+			}
+			for i := range paths {
+				if paths[i] != tt.wantPaths[i] {
+					t.Errorf("diffKeyValues() paths = %q, want %q", paths, tt.wantPaths)
+				}
+			}
+			if got := applyStructChanges(original, changes); got != tt.want {
+				t.Errorf("applyStructChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compareFilesProperties(t *testing.T) {
+	defer func() { prompts = nil }()
+
+	tmpDir, err := ioutil.TempDir("", "properties")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	original := writeTestFile(filepath.Join(tmpDir, "a/app.properties"), "# pool\npool.size=10\npool.timeout=30\n")
+	desired := writeTestFile(filepath.Join(tmpDir, "b/app.properties"), "pool.timeout = 60\npool.size = 20\npool.name = web\n")
+
+	// Review the file, take the timeout and the name, skip the size
+	setAnswers("y\ny\nn\ny\n")
+	equal, err := compareFiles(original, desired, false, false)
+	if err != nil || equal {
+		t.Errorf("compareFiles() = %v, %v, want false", equal, err)
+	}
+	content, _ := ioutil.ReadFile(original.osPathname)
+	if want := "# pool\npool.size=10\npool.name = web\npool.timeout=60\n"; string(content) != want {
+		t.Errorf("compareFiles() = %q, want %q", content, want)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// splitLinesKeepEnds splits s into lines, each line keeps its trailing newline.
+// This matches how diffmatchpatch breaks up text in line mode.
+func splitLinesKeepEnds(s string) []string {
+	var lines []string
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\n')
+		if i == -1 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+// lineCompareActive reports if any option changes how lines are compared.
+func lineCompareActive() bool {
+	return ignoreSpaceChange || ignoreAllSpace || ignoreBlankLines || ignoreCase || len(ignoreLineRegexps) > 0
+}
+
+// compileRegexps compiles every pattern, the first invalid pattern is returned as an error.
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	regexps := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		regexps = append(regexps, re)
+	}
+	return regexps, nil
+}
+
+// lineKey returns the value a line is compared by, lines with
+// the same key are considered equal.
+func lineKey(line string) string {
+	body := strings.TrimSuffix(line, "\n")
+	ending := line[len(body):]
+
+	if ignoreAllSpace {
+		body = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, body)
+	} else if ignoreSpaceChange {
+		// Like diff -b, runs of white space compare equal and trailing white space is dropped.
+		trimmed := strings.TrimLeftFunc(body, unicode.IsSpace)
+		prefix := ""
+		if trimmed != body && trimmed != "" {
+			prefix = " "
+		}
+		body = prefix + strings.Join(strings.Fields(trimmed), " ")
+	}
+
+	if ignoreCase {
+		body = strings.ToLower(body)
+	}
+
+	return body + ending
+}
+
+func isBlankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// lineIgnored reports if a changed line should not count as a difference.
+func lineIgnored(line string) bool {
+	if ignoreBlankLines && isBlankLine(line) {
+		return true
+	}
+
+	body := strings.TrimSuffix(line, "\n")
+	for _, re := range ignoreLineRegexps {
+		if re.MatchString(body) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeLines rewrites text the way its lines are compared, every line
+// is replaced by its key and ignored lines are left out.
+func normalizeLines(text string) string {
+	if !lineCompareActive() {
+		return text
+	}
+	var out strings.Builder
+	for _, line := range splitLinesKeepEnds(text) {
+		if !lineIgnored(line) {
+			out.WriteString(lineKey(line))
+		}
+	}
+	return out.String()
+}
+
+// linesToRunes maps every line to a rune so the lines can be diffed as characters.
+// Lines with the same key share a rune.
+func linesToRunes(lines []string, keyRunes map[string]rune) []rune {
+	return tokensToRunes(lines, keyRunes, lineKey)
+}
+
+// tokensToRunes maps every token to a rune by its key, surrogate code points
+// are skipped as they do not survive the conversion to a string.
+func tokensToRunes(tokens []string, keyRunes map[string]rune, key func(string) string) []rune {
+	runes := make([]rune, 0, len(tokens))
+	for _, token := range tokens {
+		tokenKey := key(token)
+		r, ok := keyRunes[tokenKey]
+		if !ok {
+			r = rune(len(keyRunes) + 1)
+			if r >= 0xD800 {
+				r += 0x800
+			}
+			keyRunes[tokenKey] = r
+		}
+		runes = append(runes, r)
+	}
+	return runes
+}
+
+// runeDiffsToText rehydrates diffs made over runes from tokensToRunes back
+// into the original tokens. Equal runs always carry the tokens from tokensA.
+func runeDiffsToText(runeDiffs []diffmatchpatch.Diff, tokensA []string, tokensB []string) []diffmatchpatch.Diff {
+	diffs := make([]diffmatchpatch.Diff, 0, len(runeDiffs))
+	posA, posB := 0, 0
+	for _, runeDiff := range runeDiffs {
+		count := utf8.RuneCountInString(runeDiff.Text)
+		diff := diffmatchpatch.Diff{Type: runeDiff.Type}
+		switch runeDiff.Type {
+		case diffmatchpatch.DiffEqual:
+			diff.Text = strings.Join(tokensA[posA:posA+count], "")
+			posA += count
+			posB += count
+		case diffmatchpatch.DiffDelete:
+			diff.Text = strings.Join(tokensA[posA:posA+count], "")
+			posA += count
+		case diffmatchpatch.DiffInsert:
+			diff.Text = strings.Join(tokensB[posB:posB+count], "")
+			posB += count
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// diffLineMode creates a line based diff between textA and textB.
+// Equal lines always carry the text from textA so patches made from
+// the diffs only contain the changes the user has not asked to ignore.
+func diffLineMode(dmp *diffmatchpatch.DiffMatchPatch, textA string, textB string) []diffmatchpatch.Diff {
+	linesA := splitLinesKeepEnds(textA)
+	linesB := splitLinesKeepEnds(textB)
+
+	keyRunes := make(map[string]rune)
+	runesA := linesToRunes(linesA, keyRunes)
+	runesB := linesToRunes(linesB, keyRunes)
+
+	// Cleaning up before the lines are restored keeps every change on whole lines
+	runeDiffs := dmp.DiffCleanupSemantic(diffRunes(dmp, diffAlgorithm, runesA, runesB))
+
+	return dropIgnoredChanges(runeDiffsToText(runeDiffs, linesA, linesB))
+}
+
+// dropIgnoredChanges turns groups of changes that only touch ignored lines
+// back into unchanged text from the original, so they are neither
+// displayed nor offered as patches.
+func dropIgnoredChanges(diffs []diffmatchpatch.Diff) []diffmatchpatch.Diff {
+	result := []diffmatchpatch.Diff{}
+
+	for i := 0; i < len(diffs); {
+		if diffs[i].Type == diffmatchpatch.DiffEqual {
+			result = appendDiff(result, diffs[i])
+			i++
+			continue
+		}
+
+		groupEnd := i
+		ignored := true
+		for groupEnd < len(diffs) && diffs[groupEnd].Type != diffmatchpatch.DiffEqual {
+			for _, line := range splitLinesKeepEnds(diffs[groupEnd].Text) {
+				if !lineIgnored(line) {
+					ignored = false
+				}
+			}
+			groupEnd++
+		}
+
+		for _, diff := range diffs[i:groupEnd] {
+			if !ignored {
+				result = appendDiff(result, diff)
+			} else if diff.Type == diffmatchpatch.DiffDelete {
+				result = appendDiff(result, diffmatchpatch.Diff{Type: diffmatchpatch.DiffEqual, Text: diff.Text})
+			}
+		}
+		i = groupEnd
+	}
+
+	return result
+}
+
+// diffHasChanges reports if any insert or delete remains in diffs.
+func diffHasChanges(diffs []diffmatchpatch.Diff) bool {
+	for _, diff := range diffs {
+		if diff.Type != diffmatchpatch.DiffEqual {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func setLineCompareOptions(spaceChange bool, allSpace bool, blankLines bool, caseInsensitive bool) {
+	ignoreSpaceChange = spaceChange
+	ignoreAllSpace = allSpace
+	ignoreBlankLines = blankLines
+	ignoreCase = caseInsensitive
+}
+
+func Test_splitLinesKeepEnds(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"Empty", "", nil},
+		{"NoNewline", "a", []string{"a"}},
+		{"Newlines", "a\nb\n", []string{"a\n", "b\n"}},
+		{"MissingLastNewline", "a\n\nb", []string{"a\n", "\n", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitLinesKeepEnds(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitLinesKeepEnds() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lineKey(t *testing.T) {
+	defer setLineCompareOptions(false, false, false, false)
+
+	tests := []struct {
+		name        string
+		spaceChange bool
+		allSpace    bool
+		ignoreCase  bool
+		lineA       string
+		lineB       string
+		want        bool
+	}{
+		{"Default", false, false, false, "a = 1\n", "a  = 1\n", false},
+		{"SpaceChange", true, false, false, "a = 1\n", "a  =\t1  \n", true},
+		{"SpaceChangeLeading", true, false, false, "a = 1\n", "  a = 1\n", false},
+		{"SpaceChangeIndent", true, false, false, "  a = 1\n", "\ta = 1\n", true},
+		{"AllSpace", false, true, false, "a = 1\n", "a=1\n", true},
+		{"AllSpaceNewline", false, true, false, "a = 1\n", "a=1", false},
+		{"Case", false, false, true, "Name = A\n", "name = a\n", true},
+		{"CaseAndSpace", false, true, true, "Name = A\n", "name=a\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLineCompareOptions(tt.spaceChange, tt.allSpace, false, tt.ignoreCase)
+			if got := lineKey(tt.lineA) == lineKey(tt.lineB); got != tt.want {
+				t.Errorf("lineKey(%q) == lineKey(%q) = %v, want %v", tt.lineA, tt.lineB, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compileRegexps(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		wantLen  int
+		wantErr  bool
+	}{
+		{"Empty", []string{}, 0, false},
+		{"Valid", []string{"^#", "timestamp"}, 2, false},
+		{"Invalid", []string{"^#", "(unclosed"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compileRegexps(tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compileRegexps() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.wantLen {
+				t.Errorf("compileRegexps() = %v, want %v regexps", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func Test_diffLineMode(t *testing.T) {
+	defer setLineCompareOptions(false, false, false, false)
+	defer func() { ignoreLineRegexps = nil }()
+
+	textA := "a = 1\nb = 2\n\nc = 3\n"
+
+	tests := []struct {
+		name        string
+		spaceChange bool
+		blankLines  bool
+		patterns    []string
+		textB       string
+		wantChanges bool
+		wantText1   string
+	}{
+		{"Same", false, false, nil, textA, false, textA},
+		{"SpaceOnly", false, false, nil, "a  = 1\nb = 2\n\nc = 3\n", true, textA},
+		{"SpaceOnlyIgnored", true, false, nil, "a  = 1\nb = 2\n\nc = 3\n", false, textA},
+		{"BlankOnly", false, false, nil, "a = 1\nb = 2\nc = 3\n\n", true, textA},
+		{"BlankOnlyIgnored", false, true, nil, "a = 1\nb = 2\nc = 3\n\n", false, textA},
+		{"RealChangeKept", true, true, nil, "a  = 1\nb = 4\nc = 3\n", true, textA},
+		{"MatchingLine", false, false, nil, "a = 1\nb = 4\n\nc = 3\n", true, textA},
+		{"MatchingLineIgnored", false, false, []string{"^b = "}, "a = 1\nb = 4\n\nc = 3\n", false, textA},
+		{"MatchingLineMixed", false, false, []string{"^b = "}, "a = 2\nb = 4\n\nc = 3\n", true, textA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLineCompareOptions(tt.spaceChange, false, tt.blankLines, false)
+			ignoreLineRegexps, _ = compileRegexps(tt.patterns)
+			dmp := diffmatchpatch.New()
+			diffs := diffLineMode(dmp, textA, tt.textB)
+			if got := diffHasChanges(diffs); got != tt.wantChanges {
+				t.Errorf("diffHasChanges() = %v, want %v, diffs %v", got, tt.wantChanges, diffs)
+			}
+			if got := dmp.DiffText1(diffs); got != tt.wantText1 {
+				t.Errorf("DiffText1() = %q, want %q", got, tt.wantText1)
+			}
+		})
+	}
+}
+
+func Test_compareFilesIgnoreSpace(t *testing.T) {
+	defer setLineCompareOptions(false, false, false, false)
+
+	// Compared line by line, as Terraform only the values count
+	tmpDir, err := ioutil.TempDir("", "whitespace")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	contentA, _ := ioutil.ReadFile("testdata/whitespace/a.tf")
+	contentB, _ := ioutil.ReadFile("testdata/whitespace/b.tf")
+	fileA := writeTestFile(filepath.Join(tmpDir, "a.txt"), string(contentA))
+	fileB := writeTestFile(filepath.Join(tmpDir, "b.txt"), string(contentB))
+
+	tests := []struct {
+		name        string
+		spaceChange bool
+		blankLines  bool
+		want        bool
+	}{
+		{"Default", false, false, false},
+		{"SpaceChangeOnly", true, false, false},
+		{"SpaceAndBlank", true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLineCompareOptions(tt.spaceChange, false, tt.blankLines, false)
+			got, err := compareFiles(fileA, fileB, true, true)
+			if err != nil {
+				t.Errorf("compareFiles() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("compareFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diffLineModeWholeLines(t *testing.T) {
+	dmp := diffmatchpatch.New()
+	textA := "env = \"qa\"\n\n\nversion = \"5.0.6\"\nsize = \"small\"\n"
+	textB := "env = \"dev\"\n\n\nversion = \"5.0.8\"\nsize = \"small\"\n"
+
+	diffs := diffLineMode(dmp, textA, textB)
+	for _, diff := range diffs {
+		if !strings.HasSuffix(diff.Text, "\n") {
+			t.Errorf("diffLineMode() split a line: %q", diff.Text)
+		}
+	}
+	if got := dmp.DiffText2(diffs); got != textB {
+		t.Errorf("DiffText2() = %q, want %q", got, textB)
+	}
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"html/template"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
@@ -25,14 +28,50 @@ var ignorePaths []string
 var includeHidden bool = false
 var followSymLinks bool = false
 var enableDebugLogs bool = false
+var ignoreSpaceChange bool = false
+var ignoreAllSpace bool = false
+var ignoreBlankLines bool = false
+var ignoreCase bool = false
+var ignoreMatchingLines []string
+var ignoreLineRegexps []*regexp.Regexp
+var diffContext int = 1
+var diffAlgorithm string = "myers"
+var wordDiff string = "none"
+var findRenamesThreshold int = 0
+var pathMapRules []string
+var pathMappings []pathMapping
+var substituteRules []string
+var substitutions []substitution
+var intoTargets []string
+var reverseDirection bool = false
+var writeBoth bool = false
+var gitStage bool = false
+var allowDirty bool = false
+var defaultAnswer string = "fail"
+var jsonPatchPath string
+var unifiedPatchPath string
+var ignoreKeys []string
+var ignoreKeyRegexps []*regexp.Regexp
+var comparatorRules []string
+var mergeTool string
+var mergeToolCommand []string
+var jobs int = 1
+var noCache bool = false
+var digestCacheFile string
+var configFile string
+var profileName string
 
 type trackedStats struct {
 	FilesScanned   int
 	FilesWDiff     int
+	FilesRenamed   int
+	FilesDirty     int
 	DirSearched    int
 	PatchesApplied int
 	PatchesSkipped int
 	PatchesErrored int
+	ToolOpened     int
+	ToolResolved   int
 	Starttime      time.Time
 	Duration       string
 }
@@ -43,6 +82,13 @@ type fileInfoExtended struct {
 	fileContent       []byte
 	fileContentString string
 	autoPatch         bool
+	gitRev            string // set when read from a git revision
+	gitPath           string
+	gitObject         string
+	archive           string // set for the root of an archive
+	memContent        []byte // content of files that are not on disk
+	readOnly          bool
+	substituted       bool // from <desired_changes>, --substitute rewrites its content
 }
 
 type fileDiffInfo struct {
@@ -52,11 +98,14 @@ type fileDiffInfo struct {
 	patchesFailed  int
 	patched        bool
 	newContent     []byte
+	desiredPatched bool
+	desiredContent []byte
 }
 
 var runtimeStats trackedStats
+var statsLock sync.Mutex
 
-var finishedResponse = `Scanned:{{"\t"}}Files: {{.FilesScanned}}{{"\t"}}Directories: {{.DirSearched}}{{"\t"}}Diffs: {{.FilesWDiff}}{{"\t"}}Patched: {{.PatchesApplied}}{{"\t"}}Skipped: {{.PatchesSkipped}}{{"\t"}}Errors: {{.PatchesErrored}} {{"\t"}}Runtime: {{.Duration}}
+var finishedResponse = `Scanned:{{"\t"}}Files: {{.FilesScanned}}{{"\t"}}Directories: {{.DirSearched}}{{"\t"}}Diffs: {{.FilesWDiff}}{{"\t"}}Renamed: {{.FilesRenamed}}{{"\t"}}Patched: {{.PatchesApplied}}{{"\t"}}Skipped: {{.PatchesSkipped}}{{"\t"}}Errors: {{.PatchesErrored}} {{"\t"}}{{if .FilesDirty}}Dirty: {{.FilesDirty}}{{"\t"}}{{end}}{{if .ToolOpened}}Tool: {{.ToolOpened}}{{"\t"}}Resolved: {{.ToolResolved}}{{"\t"}}{{end}}Runtime: {{.Duration}}
 `
 var finishedTpl = template.Must(template.New("finishedReponse").Parse(finishedResponse))
 
@@ -76,6 +125,13 @@ func logDebug(myMsg string) {
 	}
 }
 
+// countStats updates runtimeStats, files are compared concurrently with --jobs.
+func countStats(update func(stats *trackedStats)) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	update(&runtimeStats)
+}
+
 // showFinishedResults takes in an bufio writer like
 // os.Stdout for example and writes the results.
 func showFinishedResults(output *bufio.Writer, runtimeStats trackedStats) error {
@@ -93,6 +149,34 @@ func showFinishedResults(output *bufio.Writer, runtimeStats trackedStats) error
 	return nil
 }
 
+// skipPath reports if a path is hidden or matches --ignore-paths.
+func skipPath(osPathname string) bool {
+	if strings.Contains(osPathname, "/.") {
+		if !includeHidden {
+			logDebug("Hidden check: Ignoring:" + osPathname)
+			return true
+		}
+	}
+
+	for _, ignorePath := range ignorePaths {
+		if strings.Contains(osPathname, ignorePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles returns the files below a directory on disk, in a git revision or in an archive.
+func listFiles(dirExt fileInfoExtended) []fileInfoExtended {
+	if dirExt.gitRev != "" {
+		return getAllGitFiles(dirExt)
+	}
+	if dirExt.archive != "" {
+		return getAllArchiveFiles(dirExt)
+	}
+	return getAllFiles(dirExt.osPathname)
+}
+
 func getAllFiles(diffPath string) []fileInfoExtended {
 	foundFiles := []fileInfoExtended{}
 	fmt.Println("Loading files from ", diffPath)
@@ -101,11 +185,8 @@ func getAllFiles(diffPath string) []fileInfoExtended {
 		Callback: func(osPathname string, de *godirwalk.Dirent) error {
 
 			logDebug("Checking file:" + osPathname)
-			if strings.Contains(osPathname, "/.") {
-				if !includeHidden {
-					logDebug("Hidden check: Ignoring:" + osPathname)
-					return godirwalk.SkipThis
-				}
+			if skipPath(osPathname) {
+				return godirwalk.SkipThis
 			}
 
 			if de.IsSymlink() {
@@ -114,14 +195,8 @@ func getAllFiles(diffPath string) []fileInfoExtended {
 				}
 			}
 
-			for _, ignorePath := range ignorePaths {
-				if strings.Contains(osPathname, ignorePath) {
-					return godirwalk.SkipThis
-				}
-			}
-
 			if de.IsDir() {
-				runtimeStats.DirSearched++
+				countStats(func(stats *trackedStats) { stats.DirSearched++ })
 			}
 
 			if de.IsRegular() {
@@ -132,7 +207,7 @@ func getAllFiles(diffPath string) []fileInfoExtended {
 				}
 				logDebug("Including file:" + osPathname)
 				foundFiles = append(foundFiles, fInfoExt)
-				runtimeStats.FilesScanned++
+				countStats(func(stats *trackedStats) { stats.FilesScanned++ })
 
 			}
 			return nil
@@ -152,27 +227,87 @@ func getAllFiles(diffPath string) []fileInfoExtended {
 func mainWork(opt *getoptions.GetOpt, pathAExt fileInfoExtended, pathBExt fileInfoExtended) int {
 
 	runtimeStats.Starttime = time.Now()
+	jsonPatches = nil
+	unifiedDiffs.Reset()
 	bufferedOutput := bufio.NewWriter(os.Stdout)
 	defer bufferedOutput.Flush()
 
+	if rc := compareTrees(opt, pathAExt, pathBExt); rc != 0 {
+		return rc
+	}
+
+	if jsonPatchPath != "" {
+		if err := writeJSONPatches(pathAExt, pathBExt); err != nil {
+			logError("Error writing JSON Patch", err)
+			return 1
+		}
+	}
+	if unifiedPatchPath != "" {
+		if err := writeUnifiedDiffs(); err != nil {
+			logError("Error writing patch", err)
+			return 1
+		}
+	}
+
+	err := showFinishedResults(bufferedOutput, runtimeStats)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// fileKeyOf returns the path of a file below root with a leading slash,
+// the key used to pair up files between the two trees.
+func fileKeyOf(osPathname string, root string) string {
+	key := strings.TrimPrefix(osPathname, strings.TrimSuffix(root, "/")+"/")
+	if key == osPathname && root == "." {
+		key = strings.TrimPrefix(osPathname, "./")
+	}
+	return "/" + key
+}
+
+// compareTrees reviews the differences between two directories or two files.
+func compareTrees(opt *getoptions.GetOpt, pathAExt fileInfoExtended, pathBExt fileInfoExtended) int {
+	loadDirtyFiles(pathAExt)
+	if reverseDirection || writeBoth {
+		// Otherwise <desired_changes> is only written after answering r, checked file by file
+		loadDirtyFiles(pathBExt)
+	}
+	defer func() { dirtyTrees, fallbackNotices = nil, nil }()
+
 	if pathAExt.fileInfo.IsDir() && pathBExt.fileInfo.IsDir() {
 		// We are comparing directories
 		pathAExt.osPathname = filepath.Clean(pathAExt.osPathname)
 		pathBExt.osPathname = filepath.Clean(pathBExt.osPathname)
-		pathAFiles := getAllFiles(pathAExt.osPathname)
-		pathBFiles := getAllFiles(pathBExt.osPathname)
+		pathAFiles := listFiles(pathAExt)
+		pathBFiles := listFiles(pathBExt)
 
 		fileMapList := []string{}
+		onlyDesiredList := []string{}
 		fileMap := make(map[string][]fileInfoExtended)
 		for _, fileExtInfo := range pathAFiles {
-			fileKey := strings.TrimPrefix(fileExtInfo.osPathname, pathAExt.osPathname)
+			fileKey := fileKeyOf(fileExtInfo.osPathname, pathAExt.osPathname)
 			fileMap[fileKey] = []fileInfoExtended{fileExtInfo}
 			fileMapList = append(fileMapList, fileKey)
 			logDebug("Primary path:" + fileKey)
 		}
 
+		// A mapped file wins over a file that already lives at the mapped path
+		mappedKeys := make(map[string]bool)
 		for _, fileExtInfo := range pathBFiles {
-			fileKey := strings.TrimPrefix(fileExtInfo.osPathname, pathBExt.osPathname)
+			fileKey := fileKeyOf(fileExtInfo.osPathname, pathBExt.osPathname)
+			if mappedKey := mapDesiredKey(fileKey, pathMappings); mappedKey != fileKey {
+				mappedKeys[mappedKey] = true
+			}
+		}
+
+		for _, fileExtInfo := range pathBFiles {
+			unmappedKey := fileKeyOf(fileExtInfo.osPathname, pathBExt.osPathname)
+			fileKey := mapDesiredKey(unmappedKey, pathMappings)
+			if fileKey == unmappedKey && mappedKeys[fileKey] {
+				logDebug("Replaced by mapping:" + fileKey)
+				continue
+			}
 			logDebug("Secondary path:" + fileKey)
 			if _, ok := fileMap[fileKey]; ok {
 				mylist := fileMap[fileKey]
@@ -180,22 +315,55 @@ func mainWork(opt *getoptions.GetOpt, pathAExt fileInfoExtended, pathBExt fileIn
 				fileMap[fileKey] = mylist
 			} else {
 				fileMap[fileKey] = []fileInfoExtended{fileExtInfo}
+				onlyDesiredList = append(onlyDesiredList, fileKey)
+			}
+		}
+
+		onlyOriginal := []fileInfoExtended{}
+		for _, fileName := range fileMapList {
+			if len(fileMap[fileName]) == 1 {
+				onlyOriginal = append(onlyOriginal, fileMap[fileName][0])
 			}
 		}
+		onlyDesired := []fileInfoExtended{}
+		for _, fileName := range onlyDesiredList {
+			onlyDesired = append(onlyDesired, fileMap[fileName][0])
+		}
+
+		renames := findRenames(onlyOriginal, onlyDesired, findRenamesThreshold)
+		for i := range renames {
+			fileKey := mapDesiredKey(fileKeyOf(renames[i].desired.osPathname, pathBExt.osPathname), pathMappings)
+			renames[i].target = pathAExt.osPathname + fileKey
+		}
 
+		pairs := []filePair{}
 		for _, fileName := range fileMapList {
 			if len(fileMap[fileName]) == 2 {
 				// Files exist in both dirs
 				logDebug("Comparing file:" + fileName)
-				_, err := compareFiles(fileMap[fileName][0], fileMap[fileName][1], opt.Called("dry-run"), opt.Called("report-only"))
-				if err != nil {
-					return 1
-				}
+				pairs = append(pairs, filePair{fileAExt: fileMap[fileName][0], fileBExt: fileMap[fileName][1]})
 			} else {
 				logDebug("Skipping file:" + fileName)
 			}
 		}
 
+		err := compareAll(pairs, opt.Called("report-only"), func(compared comparison) error {
+			_, err := reviewComparison(compared, opt.Called("dry-run"), opt.Called("report-only"))
+			return err
+		})
+		if err != nil {
+			return 1
+		}
+
+		for _, rename := range renames {
+			logDebug("Renamed file:" + rename.original.osPathname + " -> " + rename.target)
+			err := handleRename(rename, opt.Called("dry-run"), opt.Called("report-only"))
+			if err != nil {
+				logError("Handling rename", err)
+				return 1
+			}
+		}
+
 	} else if !pathAExt.fileInfo.IsDir() && !pathBExt.fileInfo.IsDir() {
 		// We are comparing two files against each other
 		runtimeStats.FilesScanned = 2
@@ -205,11 +373,42 @@ func mainWork(opt *getoptions.GetOpt, pathAExt fileInfoExtended, pathBExt fileIn
 		}
 	}
 
-	err := showFinishedResults(bufferedOutput, runtimeStats)
+	return 0
+}
+
+// statArgument returns the file or directory named by a command line argument,
+// a path on disk, git:<rev>:<path> or stdin and pipes read into memory.
+func statArgument(arg string) (fileInfoExtended, error) {
+	if rev, gitPath, ok := parseGitPath(arg); ok {
+		return statGitPath(rev, gitPath)
+	}
+	if arg == stdinArgument {
+		return statStream(arg, os.Stdin)
+	}
+
+	fileInfo, err := os.Stat(arg)
 	if err != nil {
-		return 1
+		return fileInfoExtended{osPathname: arg, fileInfo: fileInfo}, err
 	}
-	return 0
+	if !fileInfo.IsDir() && !fileInfo.Mode().IsRegular() {
+		stream, err := os.Open(arg)
+		if err != nil {
+			return fileInfoExtended{osPathname: arg, fileInfo: fileInfo}, err
+		}
+		defer stream.Close()
+		return statStream(arg, stream)
+	}
+	return fileInfoExtended{osPathname: arg, fileInfo: fileInfo}, nil
+}
+
+// argumentError reports an argument that can not be read, with exit code
+// 127 when it does not exist.
+func argumentError(err error) int {
+	fmt.Fprintf(os.Stderr, "Error, %s\n", err)
+	if errors.Is(err, os.ErrNotExist) {
+		return 127
+	}
+	return 1
 }
 
 func program(args []string) int {
@@ -224,13 +423,39 @@ Example: ./dap original desired_changes`)
 	opt.BoolVar(&enableDebugLogs, "debug", false)
 	opt.Bool("dry-run", false, opt.Description("Dry-run skips updating the underlying file contents"))
 	opt.Bool("report-only", false, opt.Alias("q"), opt.Description("Report only files that differ"))
+	opt.BoolVar(&gitStage, "git-stage", false, opt.Description("Stages every written or moved file in the git index"))
+	opt.BoolVar(&allowDirty, "allow-dirty", false, opt.Description("Patches files even when they have uncommitted changes in git"))
+	opt.StringVar(&defaultAnswer, "default-answer", "fail", opt.Description("Answer to every question when there is no terminal to ask, one of: "+strings.Join(defaultAnswers, ", ")))
+	opt.BoolVar(&writeBoth, "write-both", false, opt.Description("Writes the resolved hunks into <desired_changes> as well, so both files end up the same, files compared by key fall back to the line diff"))
+	opt.BoolVar(&reverseDirection, "reverse", false, opt.Alias("R"), opt.Description("Brings changes into <desired_changes> from <original> instead, answer r to reverse a single file"))
 	opt.StringSliceVar(&ignorePaths, "ignore-paths", 1, 1, opt.Description("Excludes pathnames from directory search, providing a value overrides the defaults of .git and .terraform"))
 	opt.BoolVar(&includeHidden, "include-hidden", false, opt.Description("Include hidden files and directories"))
 	opt.BoolVar(&followSymLinks, "follow-sym-links", false, opt.Description("Follow symlinks"))
+	opt.BoolVar(&ignoreSpaceChange, "ignore-space-change", false, opt.Alias("b"), opt.Description("Ignore changes in the amount of white space, files compared by key fall back to the line diff"))
+	opt.BoolVar(&ignoreAllSpace, "ignore-all-space", false, opt.Alias("w"), opt.Description("Ignore all white space, files compared by key fall back to the line diff"))
+	opt.BoolVar(&ignoreBlankLines, "ignore-blank-lines", false, opt.Alias("B"), opt.Description("Ignore changes where all lines are blank, files compared by key fall back to the line diff"))
+	opt.BoolVar(&ignoreCase, "ignore-case", false, opt.Alias("i"), opt.Description("Ignore case differences in file contents, files compared by key fall back to the line diff"))
+	opt.StringSliceVar(&ignoreMatchingLines, "ignore-matching-lines", 1, 1, opt.Alias("I"), opt.Description("Ignore changes where all lines match the regular expression, files compared by key fall back to the line diff"))
+	opt.StringSliceVar(&ignoreKeys, "ignore-key", 1, 1, opt.ArgName("path"), opt.Description("Ignore changes to this key path of files compared by key, such as YAML, JSON or Terraform, * matches any text, can be repeated"))
+	opt.StringSliceVar(&comparatorRules, "comparator", 1, 1, opt.ArgName("pattern=command"), opt.Description("Compares files matching a glob on their name, or a MIME type such as image/*, with an external command speaking JSON on stdin and stdout, can be repeated"))
+	opt.StringVar(&mergeTool, "tool", "", opt.ArgName("name"), opt.Description("Answer t when reviewing a file to resolve it in this tool, one of: meld, vimdiff, code or a command using $ORIGINAL, $DESIRED and $RESULT for a three-way merge"))
+	opt.StringVar(&diffAlgorithm, "diff-algorithm", "myers", opt.Description("Diff algorithm to use: "+strings.Join(diffAlgorithms, ", ")+", files compared by key fall back to the line diff with any but myers"))
+	opt.StringVar(&wordDiff, "word-diff", "none", opt.Description("Highlight the changed words within changed lines: "+strings.Join(wordDiffModes, ", ")+", files compared by key fall back to the line diff with any but none"))
+	opt.StringSliceVar(&pathMapRules, "map", 1, 1, opt.ArgName("src_prefix=dst_prefix"), opt.Description("Pairs a subtree of <desired_changes> with a differently named subtree of <original>, can be repeated"))
+	opt.StringSliceVar(&substituteRules, "substitute", 1, 1, opt.ArgName("pattern=replacement"), opt.Description("Rewrites <desired_changes> before comparing, pattern is a regular expression, can be repeated"))
+	opt.StringVar(&configFile, "config", "", opt.ArgName("path"), opt.Description("Reads --ignore-matching-lines, --map and --substitute from this YAML file, the default is dap/config.yaml in the user config directory"))
+	opt.StringVar(&profileName, "profile", "", opt.ArgName("name"), opt.Description("Adds the options of this profile of the config file"))
+	opt.StringVar(&jsonPatchPath, "json-patch", "", opt.ArgName("path"), opt.Description("Writes the accepted changes to JSON files as RFC 6902 JSON Patch, a directory of patches when comparing directories"))
+	opt.StringVar(&unifiedPatchPath, "patch", "", opt.ArgName("path"), opt.Description("Writes the differences as a unified diff with --context lines around each change, also with --report-only"))
+	opt.StringSliceVar(&intoTargets, "into", 1, 1, opt.ArgName("original"), opt.Description("Promotes <desired_changes> into this target instead of a single <original>, can be repeated or a glob, hunks are reviewed once and reused for every target, files compared by key fall back to the line diff"))
+	opt.IntVar(&findRenamesThreshold, "find-renames", 0, opt.Alias("M"), opt.Description("Pair up files only found on one side when at least this percent of their content matches, git uses 50, 0 disables rename detection"))
+	opt.IntVar(&jobs, "jobs", 1, opt.Alias("j"), opt.Description("Number of file pairs compared at the same time, files are still reviewed one at a time and in order"))
+	opt.BoolVar(&noCache, "no-cache", false, opt.Description("Reads every file instead of using the digests cached by earlier runs for files unchanged since"))
+	opt.IntVar(&diffContext, "context", 1, opt.Alias("U"), opt.Description("Number of unchanged lines shown around each change, hunks closer than twice this are merged"))
 	// opt.Bool("report-identical-files", false, opt.Alias("s"), opt.Description("Report only files that are the same"))
-	//diffContext := opt.IntOptional("context", 3)
 
-	remaining, err := opt.Parse(args)
+	remaining, err := opt.Parse(hideStdinArguments(opt, args))
+	remaining = showStdinArguments(remaining)
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: %s\n\n", err)
@@ -247,26 +472,139 @@ Example: ./dap original desired_changes`)
 		return 0
 	}
 
+	if !validDiffAlgorithm(diffAlgorithm) {
+		fmt.Fprintf(os.Stderr, "ERROR: Unknown --diff-algorithm %s, expected one of: %s\n", diffAlgorithm, strings.Join(diffAlgorithms, ", "))
+		return 2
+	}
+
+	if !validDefaultAnswer(defaultAnswer) {
+		fmt.Fprintf(os.Stderr, "ERROR: Unknown --default-answer %s, expected one of: %s\n", defaultAnswer, strings.Join(defaultAnswers, ", "))
+		return 2
+	}
+
+	if !validWordDiffMode(wordDiff) {
+		fmt.Fprintf(os.Stderr, "ERROR: Unknown --word-diff %s, expected one of: %s\n", wordDiff, strings.Join(wordDiffModes, ", "))
+		return 2
+	}
+
+	if diffContext < 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: --context must not be negative\n")
+		return 2
+	}
+
+	if jobs < 1 {
+		fmt.Fprintf(os.Stderr, "ERROR: --jobs must be at least 1\n")
+		return 2
+	}
+
+	if userConfigFile == "" {
+		userConfigFile = defaultUserConfigFile()
+	}
+	config, err := loadConfigOptions(configFile, profileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Invalid --config: %s\n", err)
+		return 2
+	}
+	// Options from the command line come after the ones from the config
+	ignoreMatchingLines = append(config.IgnoreMatchingLines, ignoreMatchingLines...)
+	pathMapRules = append(config.Map, pathMapRules...)
+	substituteRules = append(config.Substitute, substituteRules...)
+
+	ignoreLineRegexps, err = compileRegexps(ignoreMatchingLines)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Invalid --ignore-matching-lines: %s\n", err)
+		return 2
+	}
+
+	ignoreKeyRegexps = compileKeyPatterns(ignoreKeys)
+
+	externalComparators, err = parseComparatorRules(comparatorRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Invalid --comparator: %s\n", err)
+		return 2
+	}
+
+	mergeToolCommand = nil
+	if opt.Called("tool") {
+		mergeToolCommand, err = parseMergeTool(mergeTool)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Invalid --tool: %s\n", err)
+			return 2
+		}
+	}
+
+	pathMappings, err = parsePathMappings(pathMapRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Invalid --map: %s\n", err)
+		return 2
+	}
+
+	substitutions, err = parseSubstitutions(substituteRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Invalid --substitute: %s\n", err)
+		return 2
+	}
+
+	if writeBoth && (lineCompareActive() || len(substitutions) > 0 || len(ignoreKeyRegexps) > 0) {
+		fmt.Fprintf(os.Stderr, "ERROR: --write-both can not be used with options that ignore or substitute differences\n")
+		return 2
+	}
+
+	digests = nil
+	if !noCache {
+		if digestCacheFile == "" {
+			digestCacheFile = defaultDigestCacheFile()
+		}
+		digests = loadDigestCache(digestCacheFile)
+		defer func() {
+			if err := digests.save(); err != nil {
+				logError("Error writing digest cache", err)
+				fmt.Fprintln(os.Stderr)
+			}
+		}()
+	}
+
+	if len(intoTargets) > 0 {
+		if reverseDirection || writeBoth {
+			fmt.Fprintf(os.Stderr, "ERROR: --reverse and --write-both can not be used with --into\n")
+			return 2
+		}
+		if jsonPatchPath != "" {
+			fmt.Fprintf(os.Stderr, "ERROR: --json-patch can not be used with --into\n")
+			return 2
+		}
+		if unifiedPatchPath != "" {
+			fmt.Fprintf(os.Stderr, "ERROR: --patch can not be used with --into\n")
+			return 2
+		}
+		if mergeToolCommand != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: --tool can not be used with --into\n")
+			return 2
+		}
+		return promoteProgram(opt, remaining)
+	}
+
 	if len(remaining) != 2 {
 		fmt.Fprintf(os.Stderr, "ERROR: Missing required arguments!\n")
 		fmt.Fprint(os.Stderr, opt.Help())
 		return 2
 	}
 
-	pathA, err := os.Stat(remaining[0])
-	if os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error, No such file or directory: %s\n", remaining[0])
-		return 127
+	if remaining[0] == stdinArgument {
+		fmt.Fprintf(os.Stderr, "ERROR: %s can only be used for <desired_changes>\n", stdinArgument)
+		return 2
 	}
 
-	pathB, err := os.Stat(remaining[1])
-	if os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error, No such file or directory: %s\n", remaining[1])
-		return 127
+	pathAExtened, err := statArgument(remaining[0])
+	if err != nil {
+		return argumentError(err)
 	}
 
-	pathAExtened := fileInfoExtended{osPathname: remaining[0], fileInfo: pathA}
-	pathBExtened := fileInfoExtended{osPathname: remaining[1], fileInfo: pathB}
+	pathBExtened, err := statArgument(remaining[1])
+	if err != nil {
+		return argumentError(err)
+	}
+	pathAExtened, pathBExtened = openArchive(pathAExtened, pathBExtened), openArchive(pathBExtened, pathAExtened)
 
 	return mainWork(opt, pathAExtened, pathBExtened)
 }
@@ -3,6 +3,10 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
@@ -10,6 +14,19 @@ import (
 	"github.com/DavidGamba/go-getoptions"
 )
 
+func TestMain(m *testing.M) {
+	// Keep the digests of test files out of the cache of the user, and the config of the user out of the tests
+	cacheDir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		log.Fatal(err)
+	}
+	digestCacheFile = filepath.Join(cacheDir, "digests.json")
+	userConfigFile = filepath.Join(cacheDir, "config.yaml")
+	code := m.Run()
+	os.RemoveAll(cacheDir)
+	os.Exit(code)
+}
+
 func Test_showFinishedResults(t *testing.T) {
 
 	runtimeStats := trackedStats{}
@@ -40,9 +57,11 @@ func Test_mainWork(t *testing.T) {
 
 	defer func() {
 		enableDebugLogs = false
+		prompts = nil
 	}()
 
 	enableDebugLogs = true
+	prompts = fixedPrompter{answer: "n"}
 	fileA := loadTestFile("testdata/same/a/t1.txt")
 	fileB := loadTestFile("testdata/same/b/t1.txt")
 
@@ -156,14 +175,101 @@ func Test_program(t *testing.T) {
 		{"WrongArgs", args{args: []string{"--sfdsfsdfsdf"}}, 2},
 		{"OneArg", args{args: []string{"testdata/same/a/t1.txt"}}, 2},
 		{"MissingPath", args{args: []string{"testdata/fakedir/a/t1.txt", "testdata/same/a/t1.txt"}}, 127},
+		{"NotADirectory", args{args: []string{"testdata/same/a/t1.txt/t1.txt", "testdata/same/a/t1.txt"}}, 1},
 		{"MissingPath2", args{args: []string{"testdata/same/a/t1.txt", "testdata/fakedir/a/t1.txt"}}, 127},
 		{"NoDiff", args{args: []string{"testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 0},
+		{"BadIgnoreRegexp", args{args: []string{"--ignore-matching-lines", "(", "testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 2},
+		{"BadDiffAlgorithm", args{args: []string{"--diff-algorithm", "bogus", "testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 2},
+		{"BadWordDiff", args{args: []string{"--word-diff", "words", "testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 2},
+		{"BadMap", args{args: []string{"--map", "dev", "testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 2},
+		{"BadSubstitute", args{args: []string{"--substitute", "(dev=prod", "testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 2},
+		{"IntoTwoArgs", args{args: []string{"--into", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 2},
+		{"IntoNoMatch", args{args: []string{"--into", "testdata/fakedir/*", "testdata/same/b/t1.txt"}}, 2},
+		{"IntoOnlySource", args{args: []string{"--into", "testdata/same/b/t1*", "testdata/same/b/t1.txt"}}, 2},
+		{"IntoMissing", args{args: []string{"--into", "testdata/fakedir/t1.txt", "testdata/same/b/t1.txt"}}, 127},
+		{"IntoDirAndFile", args{args: []string{"--into", "testdata/same/a", "testdata/same/b/t1.txt"}}, 2},
+		{"IntoNoDiff", args{args: []string{"--into", "testdata/same/a/t*.txt", "testdata/same/b/t1.txt"}}, 0},
+		{"ReverseInto", args{args: []string{"--reverse", "--into", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"ReverseNoDiff", args{args: []string{"--reverse", "testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 0},
+		{"WriteBothIgnoring", args{args: []string{"--write-both", "-w", "testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 2},
+		{"WriteBothInto", args{args: []string{"--write-both", "--into", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"OriginalStdin", args{args: []string{"-", "testdata/same/a/t1.txt"}}, 2},
+		{"IntoStdin", args{args: []string{"--into", "-", "testdata/same/b/t1.txt"}}, 2},
+		{"BadDefaultAnswer", args{args: []string{"--default-answer", "maybe", "testdata/same/b/t1.txt", "testdata/same/a/t1.txt"}}, 2},
+		{"WriteBothIgnoreKey", args{args: []string{"--write-both", "--ignore-key", "*/tags", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"BadComparator", args{args: []string{"--comparator", "*.xml", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"JSONPatchInto", args{args: []string{"--json-patch", "out.json", "--into", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"PatchInto", args{args: []string{"--patch", "out.diff", "--into", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"BadTool", args{args: []string{"--tool", " ", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"ToolInto", args{args: []string{"--tool", "meld", "--into", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"BadJobs", args{args: []string{"-j", "0", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"ParallelReportOnly", args{args: []string{"-j", "4", "-q", "testdata/same/a", "testdata/same/b"}}, 0},
+		{"NoCache", args{args: []string{"--no-cache", "-q", "testdata/same/a", "testdata/same/b"}}, 0},
+		{"MissingConfig", args{args: []string{"--config", "testdata/fakedir/dap.yaml", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"UnknownProfile", args{args: []string{"--profile", "prod", "testdata/same/a/t1.txt", "testdata/same/b/t1.txt"}}, 2},
+		{"MissingGitRev", args{args: []string{"git:no-such-rev:testdata/same/a", "testdata/same/b"}}, 127},
+		{"IgnoreRegexp", args{args: []string{"-q", "-I", "^  (node|engine|at_rest|visibility|nodes)", "testdata/smalldiff/t1.txt", "testdata/smalldiff/t2.txt"}}, 0},
 	}
 	for _, tt := range tests {
+		ignoreMatchingLines = nil
+		ignoreLineRegexps = nil
+		pathMapRules = nil
+		substituteRules = nil
+		intoTargets = nil
+		reverseDirection = false
+		writeBoth = false
+		gitStage, allowDirty = false, false
+		defaultAnswer = "fail"
+		jsonPatchPath, unifiedPatchPath = "", ""
+		ignoreKeys = nil
+		comparatorRules = nil
 		t.Run(tt.name, func(t *testing.T) {
 			if got := program(tt.args.args); got != tt.want {
 				t.Errorf("program() = %v, want %v", got, tt.want)
 			}
 		})
 	}
+
+	ignoreMatchingLines = nil
+	ignoreLineRegexps = nil
+	pathMapRules = nil
+	pathMappings = nil
+	substituteRules = nil
+	substitutions = nil
+	intoTargets = nil
+	reverseDirection = false
+	writeBoth = false
+	defaultAnswer = "fail"
+	jsonPatchPath, unifiedPatchPath = "", ""
+	ignoreKeys = nil
+	ignoreKeyRegexps = nil
+	comparatorRules = nil
+	externalComparators = nil
+	mergeToolCommand = nil
+	jobs = 1
+	noCache = false
+	digests = nil
+}
+
+func Test_fileKeyOf(t *testing.T) {
+	tests := []struct {
+		name       string
+		osPathname string
+		root       string
+		want       string
+	}{
+		{"Dir", "testdata/same/a/t1.txt", "testdata/same/a", "/t1.txt"},
+		{"Current", "dev/main.tf", ".", "/dev/main.tf"},
+		{"CurrentHidden", ".hidden", ".", "/.hidden"},
+		{"Root", "/etc/hosts", "/", "/etc/hosts"},
+		{"Git", "git:v1:envs/dev/main.tf", "git:v1:envs/dev", "/main.tf"},
+		{"GitCurrent", "git:v1:./dev/main.tf", "git:v1:.", "/dev/main.tf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fileKeyOf(tt.osPathname, tt.root); got != tt.want {
+				t.Errorf("fileKeyOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
 }
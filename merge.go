@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// hunkResolution is the content the user picks for a hunk.
+type hunkResolution int
+
+const (
+	resolveSkip hunkResolution = iota
+	resolveDesired
+	resolveOriginal
+	resolveOriginalThenDesired
+	resolveDesiredThenOriginal
+)
+
+// resolveChange returns the text that replaces a change, deleted holds the
+// lines from the original and inserted the lines from the desired changes.
+func resolveChange(resolution hunkResolution, deleted string, inserted string) string {
+	switch resolution {
+	case resolveDesired:
+		return inserted
+	case resolveOriginal:
+		return deleted
+	case resolveOriginalThenDesired:
+		return joinLines(deleted, inserted)
+	case resolveDesiredThenOriginal:
+		return joinLines(inserted, deleted)
+	}
+	return deleted
+}
+
+// joinLines appends second to first, ending first with a newline when
+// it was the last line of a file without one.
+func joinLines(first string, second string) string {
+	if first != "" && second != "" && !strings.HasSuffix(first, "\n") {
+		first += "\n"
+	}
+	return first + second
+}
+
+// resolveHunk returns the lines of the original a hunk spans, context
+// included, and the lines they are replaced with for resolution.
+func resolveHunk(hunk diffHunk, resolution hunkResolution) (string, string) {
+	before, after := "", ""
+	deleted, inserted := "", ""
+	resolve := func() {
+		after += resolveChange(resolution, deleted, inserted)
+		deleted, inserted = "", ""
+	}
+	for _, diff := range hunk.diffs {
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			resolve()
+			before += diff.Text
+			after += diff.Text
+		case diffmatchpatch.DiffDelete:
+			before += diff.Text
+			deleted += diff.Text
+		case diffmatchpatch.DiffInsert:
+			inserted += diff.Text
+		}
+	}
+	resolve()
+	return before, after
+}
+
+// mergeHunks rebuilds both texts from diffs with the resolved hunks in place.
+// The desired text only takes the resolved hunks with --write-both, which
+// requires the unchanged text in diffs to be the same on both sides.
+func mergeHunks(diffs []diffmatchpatch.Diff, hunks []diffHunk) (string, string) {
+	var textA, textB strings.Builder
+
+	for i := 0; i < len(diffs); {
+		if diffs[i].Type == diffmatchpatch.DiffEqual {
+			textA.WriteString(diffs[i].Text)
+			textB.WriteString(diffs[i].Text)
+			i++
+			continue
+		}
+
+		deleted, inserted := "", ""
+		j := i
+		for ; j < len(diffs) && diffs[j].Type != diffmatchpatch.DiffEqual; j++ {
+			if diffs[j].Type == diffmatchpatch.DiffDelete {
+				deleted += diffs[j].Text
+			} else {
+				inserted += diffs[j].Text
+			}
+		}
+
+		resolution := resolveSkip
+		for _, hunk := range hunks {
+			if i >= hunk.first && i <= hunk.last {
+				resolution = hunk.resolution
+			}
+		}
+
+		if resolution == resolveSkip {
+			textA.WriteString(deleted)
+			textB.WriteString(inserted)
+		} else {
+			result := resolveChange(resolution, deleted, inserted)
+			textA.WriteString(result)
+			if writeBoth {
+				textB.WriteString(result)
+			} else {
+				textB.WriteString(inserted)
+			}
+		}
+		i = j
+	}
+
+	return textA.String(), textB.String()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func Test_resolveChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		resolution hunkResolution
+		deleted    string
+		inserted   string
+		want       string
+	}{
+		{"Desired", resolveDesired, "a\n", "b\n", "b\n"},
+		{"Original", resolveOriginal, "a\n", "b\n", "a\n"},
+		{"OriginalThenDesired", resolveOriginalThenDesired, "a\n", "b\n", "a\nb\n"},
+		{"DesiredThenOriginal", resolveDesiredThenOriginal, "a\n", "b\n", "b\na\n"},
+		{"NoNewline", resolveOriginalThenDesired, "a", "b", "a\nb"},
+		{"OnlyInserted", resolveOriginalThenDesired, "", "b\n", "b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveChange(tt.resolution, tt.deleted, tt.inserted); got != tt.want {
+				t.Errorf("resolveChange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeHunks(t *testing.T) {
+	defer func() { writeBoth = false }()
+
+	dmp := diffmatchpatch.New()
+	textA := "a\nb\nc\nd\ne\nf\ng\n"
+	textB := "a\nB\nc\nd\ne\nF\ng\n"
+	diffs := diffLineMode(dmp, textA, textB)
+	hunks := groupHunks(diffs, 1)
+	if len(hunks) != 2 {
+		t.Fatalf("groupHunks() = %v hunks, want 2", len(hunks))
+	}
+
+	tests := []struct {
+		name   string
+		both   bool
+		first  hunkResolution
+		second hunkResolution
+		wantA  string
+		wantB  string
+	}{
+		{"Desired", false, resolveDesired, resolveSkip, "a\nB\nc\nd\ne\nf\ng\n", textB},
+		{"Combined", false, resolveOriginalThenDesired, resolveDesiredThenOriginal, "a\nb\nB\nc\nd\ne\nF\nf\ng\n", textB},
+		{"BothDesired", true, resolveDesired, resolveSkip, "a\nB\nc\nd\ne\nf\ng\n", textB},
+		{"BothOriginal", true, resolveOriginal, resolveDesired, "a\nb\nc\nd\ne\nF\ng\n", "a\nb\nc\nd\ne\nF\ng\n"},
+		{"BothCombined", true, resolveOriginalThenDesired, resolveSkip, "a\nb\nB\nc\nd\ne\nf\ng\n", "a\nb\nB\nc\nd\ne\nF\ng\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeBoth = tt.both
+			selected := []diffHunk{}
+			for i, resolution := range []hunkResolution{tt.first, tt.second} {
+				if resolution != resolveSkip {
+					hunk := hunks[i]
+					hunk.resolution = resolution
+					selected = append(selected, hunk)
+				}
+			}
+			gotA, gotB := mergeHunks(diffs, selected)
+			if gotA != tt.wantA {
+				t.Errorf("mergeHunks() original = %q, want %q", gotA, tt.wantA)
+			}
+			if gotB != tt.wantB {
+				t.Errorf("mergeHunks() desired = %q, want %q", gotB, tt.wantB)
+			}
+		})
+	}
+}
+
+func Test_askForResolution(t *testing.T) {
+	defer func() { prompts = nil }()
+
+	tests := []struct {
+		name  string
+		input string
+		want  hunkResolution
+		err   error
+	}{
+		{"Yes", "y", resolveDesired, nil},
+		{"No", "n", resolveSkip, nil},
+		{"Original", "o", resolveOriginal, nil},
+		{"OriginalThenDesired", "a", resolveOriginalThenDesired, nil},
+		{"DesiredThenOriginal", "B", resolveDesiredThenOriginal, nil},
+		{"Unknown", "x\no", resolveOriginal, nil},
+		{"Quit", "q", resolveSkip, ErrorCanceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAnswers(tt.input)
+
+			got, err := askForResolution()
+			if got != tt.want {
+				t.Errorf("askForResolution() = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("askForResolution() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func Test_compareFilesWriteBoth(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer func() { writeBoth = false }()
+
+	textA := "a\nb\nc\nd\ne\nf\ng\n"
+	textB := "a\nB\nc\nd\ne\nF\ng\n"
+
+	tests := []struct {
+		name  string
+		both  bool
+		input string
+		wantA string
+		wantB string
+	}{
+		{"OriginalOnly", false, "y\no\na\n", "a\nb\nc\nd\ne\nf\nF\ng\n", textB},
+		{"Both", true, "y\no\na\n", "a\nb\nc\nd\ne\nf\nF\ng\n", "a\nb\nc\nd\ne\nf\nF\ng\n"},
+		{"Skipped", true, "y\nn\nn\n", textA, textB},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "merge")
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+			fileA := writeTestFile(filepath.Join(tmpDir, "a.txt"), textA)
+			fileB := writeTestFile(filepath.Join(tmpDir, "b.txt"), textB)
+
+			setAnswers(tt.input)
+
+			writeBoth = tt.both
+			if _, err := compareFiles(fileA, fileB, false, false); err != nil {
+				t.Errorf("compareFiles() error = %v", err)
+			}
+
+			gotA, _ := ioutil.ReadFile(fileA.osPathname)
+			gotB, _ := ioutil.ReadFile(fileB.osPathname)
+			if string(gotA) != tt.wantA {
+				t.Errorf("compareFiles() original = %q, want %q", gotA, tt.wantA)
+			}
+			if string(gotB) != tt.wantB {
+				t.Errorf("compareFiles() desired = %q, want %q", gotB, tt.wantB)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+// filePair is a file of <original> and the file of <desired_changes> it is compared with.
+type filePair struct {
+	fileAExt fileInfoExtended
+	fileBExt fileInfoExtended
+}
+
+// compareAll compares the pairs with --jobs workers and hands every
+// comparison to review in the order of pairs, one at a time, so the
+// questions and the output do not depend on which worker is done first.
+// Workers stay a few pairs ahead of the review at most, the content of
+// files that differ is held until they are reviewed. It stops at the
+// first error returned by review.
+func compareAll(pairs []filePair, reportOnly bool, review func(compared comparison) error) error {
+	if jobs <= 1 {
+		for _, pair := range pairs {
+			if err := review(compareContent(pair.fileAExt, pair.fileBExt, reportOnly)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	results := make([]chan comparison, len(pairs))
+	for i := range results {
+		results[i] = make(chan comparison, 1)
+	}
+	ahead := make(chan struct{}, jobs*4)
+	work := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(work)
+		for i := range pairs {
+			select {
+			case ahead <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case work <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+	for worker := 0; worker < jobs; worker++ {
+		go func() {
+			for i := range work {
+				results[i] <- compareContent(pairs[i].fileAExt, pairs[i].fileBExt, reportOnly)
+			}
+		}()
+	}
+
+	for i := range pairs {
+		compared := <-results[i]
+		<-ahead
+		if err := review(compared); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_compareAll(t *testing.T) {
+	defer func() { jobs = 1 }()
+
+	tmpDir, err := ioutil.TempDir("", "parallel")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Every third pair differs
+	pairs := []filePair{}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("f%02d.txt", i)
+		content := fmt.Sprintf("line %d\n", i)
+		desired := content
+		if i%3 == 0 {
+			desired = "changed\n"
+		}
+		pairs = append(pairs, filePair{
+			fileAExt: writeTestFile(filepath.Join(tmpDir, "a", name), content),
+			fileBExt: writeTestFile(filepath.Join(tmpDir, "b", name), desired),
+		})
+	}
+
+	errStop := errors.New("stop")
+	tests := []struct {
+		name    string
+		jobs    int
+		stopAt  int
+		want    int
+		wantErr error
+	}{
+		{"Sequential", 1, -1, 50, nil},
+		{"Parallel", 8, -1, 50, nil},
+		{"MoreJobsThanPairs", 64, -1, 50, nil},
+		{"Stop", 8, 10, 11, errStop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs = tt.jobs
+			reviewed := 0
+			err := compareAll(pairs, false, func(compared comparison) error {
+				pair := pairs[reviewed]
+				if compared.fileAExt.osPathname != pair.fileAExt.osPathname {
+					t.Fatalf("compareAll() reviewed %s, want %s", compared.fileAExt.osPathname, pair.fileAExt.osPathname)
+				}
+				if compared.equal != (reviewed%3 != 0) || compared.err != nil {
+					t.Errorf("compareAll() %s equal = %v, %v", compared.fileAExt.osPathname, compared.equal, compared.err)
+				}
+				if !compared.equal && compared.fileAExt.fileContent == nil {
+					t.Errorf("compareAll() %s content not loaded", compared.fileAExt.osPathname)
+				}
+				// The diff found by the worker belongs to the pair it is handed on with
+				if !compared.equal && (len(compared.changes) != 1 || compared.changes[0].before != fmt.Sprintf("line %d", reviewed)) {
+					t.Errorf("compareAll() %s changes = %v", compared.fileAExt.osPathname, compared.changes)
+				}
+				reviewed++
+				if reviewed-1 == tt.stopAt {
+					return errStop
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("compareAll() error = %v, want %v", err, tt.wantErr)
+			}
+			if reviewed != tt.want {
+				t.Errorf("compareAll() reviewed %v pairs, want %v", reviewed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathMapping pairs a subtree of <desired_changes> with a differently
+// named subtree of <original>.
+type pathMapping struct {
+	desired  string
+	original string
+}
+
+// parsePathMappings parses --map rules in the form desired_prefix=original_prefix.
+func parsePathMappings(rules []string) ([]pathMapping, error) {
+	mappings := []pathMapping{}
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("expected src_prefix=dst_prefix, got: %s", rule)
+		}
+		mappings = append(mappings, pathMapping{
+			desired:  cleanMapPrefix(parts[0]),
+			original: cleanMapPrefix(parts[1]),
+		})
+	}
+	return mappings, nil
+}
+
+// cleanMapPrefix normalises a prefix to the form used by the fileMap keys,
+// a leading slash and no trailing slash. The root, . or /, is empty.
+func cleanMapPrefix(prefix string) string {
+	prefix = path.Clean("/" + filepath.ToSlash(prefix))
+	if prefix == "/" {
+		return ""
+	}
+	return prefix
+}
+
+// mapDesiredKey rewrites the fileMap key of a file in <desired_changes> with
+// the longest matching mapping. Prefixes only match whole path elements.
+func mapDesiredKey(fileKey string, mappings []pathMapping) string {
+	best := -1
+	for i, mapping := range mappings {
+		if mapping.desired != "" && fileKey != mapping.desired && !strings.HasPrefix(fileKey, mapping.desired+"/") {
+			continue
+		}
+		if best == -1 || len(mapping.desired) > len(mappings[best].desired) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return fileKey
+	}
+	return path.Join("/", mappings[best].original, strings.TrimPrefix(fileKey, mappings[best].desired))
+}
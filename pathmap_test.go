@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DavidGamba/go-getoptions"
+)
+
+func Test_parsePathMappings(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		want    []pathMapping
+		wantErr bool
+	}{
+		{"Empty", []string{}, []pathMapping{}, false},
+		{"Simple", []string{"dev/us-east-1=prod/eu-west-1"}, []pathMapping{{desired: "/dev/us-east-1", original: "/prod/eu-west-1"}}, false},
+		{"Slashes", []string{"/dev/=prod/"}, []pathMapping{{desired: "/dev", original: "/prod"}}, false},
+		{"ToRoot", []string{"release=."}, []pathMapping{{desired: "/release", original: ""}}, false},
+		{"FromRoot", []string{"/=release"}, []pathMapping{{desired: "", original: "/release"}}, false},
+		{"MissingEquals", []string{"dev"}, nil, true},
+		{"MissingPrefix", []string{"=prod"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePathMappings(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parsePathMappings() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePathMappings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mapDesiredKey(t *testing.T) {
+	mappings, _ := parsePathMappings([]string{"dev=prod", "dev/us-east-1=prod/eu-west-1"})
+
+	tests := []struct {
+		name    string
+		fileKey string
+		want    string
+	}{
+		{"NoMatch", "/qa/main.tf", "/qa/main.tf"},
+		{"Prefix", "/dev/main.tf", "/prod/main.tf"},
+		{"LongestPrefix", "/dev/us-east-1/main.tf", "/prod/eu-west-1/main.tf"},
+		{"WholeElementsOnly", "/dev/us-east-10/main.tf", "/prod/us-east-10/main.tf"},
+		{"NotAPrefix", "/devops/main.tf", "/devops/main.tf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapDesiredKey(tt.fileKey, mappings); got != tt.want {
+				t.Errorf("mapDesiredKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mapDesiredKeyRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		fileKey string
+		want    string
+	}{
+		{"ToDot", []string{"release=."}, "/release/main.tf", "/main.tf"},
+		{"ToSlash", []string{"release=/"}, "/release/modules/vars.tf", "/modules/vars.tf"},
+		{"ToRootOther", []string{"release=."}, "/other/main.tf", "/other/main.tf"},
+		{"FromDot", []string{".=release"}, "/main.tf", "/release/main.tf"},
+		{"FromSlash", []string{"/=release"}, "/modules/vars.tf", "/release/modules/vars.tf"},
+		{"LongestWins", []string{"/=release", "dev=prod"}, "/dev/main.tf", "/prod/main.tf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mappings, err := parsePathMappings(tt.rules)
+			if err != nil {
+				t.Fatalf("parsePathMappings() error = %v", err)
+			}
+			if got := mapDesiredKey(tt.fileKey, mappings); got != tt.want {
+				t.Errorf("mapDesiredKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mainWorkPathMap(t *testing.T) {
+	defer func() { pathMappings = nil }()
+	defer func() { prompts = nil }()
+	prompts = fixedPrompter{answer: "n"}
+
+	dirA := loadTestFile("testdata/pathmap/original")
+	dirB := loadTestFile("testdata/pathmap/desired")
+
+	optTest := getoptions.New()
+	optTest.Bool("report-only", true)
+
+	dirShared := loadTestFile("testdata/pathmap")
+
+	tests := []struct {
+		name      string
+		rules     []string
+		pathAExt  fileInfoExtended
+		pathBExt  fileInfoExtended
+		wantDiffs int
+	}{
+		{"Unmapped", nil, dirA, dirB, 0},
+		{"Mapped", []string{"dev/us-east-1=prod/eu-west-1"}, dirA, dirB, 1},
+		{"SameTree", []string{"desired/dev/us-east-1=original/prod/eu-west-1"}, dirShared, dirShared, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathMappings, _ = parsePathMappings(tt.rules)
+			before := runtimeStats.FilesWDiff
+			if got := mainWork(optTest, tt.pathAExt, tt.pathBExt); got != 0 {
+				t.Errorf("mainWork() = %v, want 0", got)
+			}
+			if got := runtimeStats.FilesWDiff - before; got != tt.wantDiffs {
+				t.Errorf("mainWork() diffs = %v, want %v", got, tt.wantDiffs)
+			}
+		})
+	}
+}
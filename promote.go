@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DavidGamba/go-getoptions"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// promotedHunk is a hunk reviewed against one target, kept as the lines
+// it replaces, context included, and the lines it replaces them with.
+type promotedHunk struct {
+	before string
+	after  string
+	startB int // first changed line in the desired changes, zero based
+	endB   int
+}
+
+// promotedHunks holds the hunks selected for each file of <desired_changes>
+// while promoting into several targets, keyed by the desired file path.
+// It is nil unless --into is used.
+var promotedHunks map[string][]promotedHunk
+
+// newPromotedHunk returns the original text of a hunk and the text it is
+// resolved to. A hunk that only inserts lines and has no context, with -U0,
+// is anchored on the line of textB before it.
+func newPromotedHunk(hunk diffHunk, textB string) promotedHunk {
+	promoted := promotedHunk{}
+	promoted.startB, promoted.endB = changedLinesB(hunk)
+	promoted.before, promoted.after = resolveHunk(hunk, hunk.resolution)
+	if promoted.before == "" && hunk.startB > 0 {
+		anchor := splitLinesKeepEnds(textB)[hunk.startB-1]
+		promoted.before, promoted.after = anchor, joinLines(anchor, promoted.after)
+	}
+	return promoted
+}
+
+// applyPromotedHunk replaces the lines of the hunk in text. A hunk only
+// applies cleanly when its lines are found exactly once, starting on a line.
+// A hunk without lines inserts at the start of the file.
+func applyPromotedHunk(hunk promotedHunk, text string) (string, bool) {
+	if hunk.before == "" {
+		return hunk.after + text, true
+	}
+
+	found := -1
+	for offset := 0; offset < len(text); {
+		index := strings.Index(text[offset:], hunk.before)
+		if index == -1 {
+			break
+		}
+		index += offset
+		offset = index + 1
+		if index > 0 && text[index-1] != '\n' {
+			continue
+		}
+		if !strings.HasSuffix(hunk.before, "\n") && index+len(hunk.before) != len(text) {
+			continue
+		}
+		if found != -1 {
+			return text, false
+		}
+		found = index
+	}
+	if found == -1 {
+		return text, false
+	}
+
+	return text[:found] + hunk.after + text[found+len(hunk.before):], true
+}
+
+// applyPromotedHunks applies the hunks to text, it returns the new text
+// and the hunks that did not apply cleanly.
+func applyPromotedHunks(hunks []promotedHunk, text string) (string, []promotedHunk) {
+	failed := []promotedHunk{}
+	for _, hunk := range hunks {
+		newText, ok := applyPromotedHunk(hunk, text)
+		if !ok {
+			failed = append(failed, hunk)
+			continue
+		}
+		text = newText
+	}
+	return text, failed
+}
+
+// changedLinesB returns the lines of the desired changes a hunk changes,
+// without its context.
+func changedLinesB(hunk diffHunk) (int, int) {
+	start, end := -1, hunk.startB
+	line := hunk.startB
+	for _, diff := range hunk.diffs {
+		if diff.Type != diffmatchpatch.DiffEqual && start == -1 {
+			start = line
+		}
+		if diff.Type != diffmatchpatch.DiffDelete {
+			line += len(splitLinesKeepEnds(diff.Text))
+		}
+		if diff.Type != diffmatchpatch.DiffEqual {
+			end = line
+		}
+	}
+	if start == -1 {
+		start = end
+	}
+	return start, end
+}
+
+// touchesPromotedHunks tells if a hunk changes lines of the desired
+// changes that one of the promoted hunks changes.
+func touchesPromotedHunks(hunk diffHunk, promoted []promotedHunk) bool {
+	start, end := changedLinesB(hunk)
+	for _, p := range promoted {
+		if start <= p.endB && p.startB <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPromotedHunks remembers the hunks selected for a file the first
+// time it is reviewed, the other targets reuse them.
+func recordPromotedHunks(fileBExt fileInfoExtended, hunks []diffHunk) {
+	if promotedHunks == nil {
+		return
+	}
+	if _, ok := promotedHunks[fileBExt.osPathname]; ok {
+		return
+	}
+	promoted := []promotedHunk{}
+	for _, hunk := range hunks {
+		promoted = append(promoted, newPromotedHunk(hunk, fileBExt.fileContentString))
+	}
+	promotedHunks[fileBExt.osPathname] = promoted
+}
+
+// expandTargets expands glob patterns in the --into targets. The source
+// itself and repeated targets are left out.
+func expandTargets(patterns []string, source string) ([]string, error) {
+	targets := []string{}
+	seen := map[string]bool{filepath.Clean(source): true}
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if _, _, ok := parseGitPath(pattern); !ok && strings.ContainsAny(pattern, "*?[") {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no targets match: %s", pattern)
+			}
+		}
+		for _, match := range matches {
+			if seen[filepath.Clean(match)] {
+				continue
+			}
+			seen[filepath.Clean(match)] = true
+			targets = append(targets, match)
+		}
+	}
+	return targets, nil
+}
+
+// addStats adds the counts of stats to total.
+func addStats(total *trackedStats, stats trackedStats) {
+	total.FilesScanned += stats.FilesScanned
+	total.FilesWDiff += stats.FilesWDiff
+	total.FilesRenamed += stats.FilesRenamed
+	total.FilesDirty += stats.FilesDirty
+	total.DirSearched += stats.DirSearched
+	total.PatchesApplied += stats.PatchesApplied
+	total.PatchesSkipped += stats.PatchesSkipped
+	total.PatchesErrored += stats.PatchesErrored
+}
+
+// promoteWork brings the changes in sourceExt into every target. Hunks are
+// reviewed the first time a file differs, later targets reuse the selection.
+func promoteWork(opt *getoptions.GetOpt, sourceExt fileInfoExtended, targets []fileInfoExtended) int {
+	promotedHunks = make(map[string][]promotedHunk)
+	defer func() { promotedHunks = nil }()
+
+	totalStats := trackedStats{Starttime: time.Now()}
+	bufferedOutput := bufio.NewWriter(os.Stdout)
+	defer bufferedOutput.Flush()
+
+	for _, target := range targets {
+		runtimeStats = trackedStats{Starttime: time.Now()}
+		fmt.Printf("Promoting into: %s, from: %s\n", target.osPathname, sourceExt.osPathname)
+		if rc := compareTrees(opt, target, sourceExt); rc != 0 {
+			return rc
+		}
+
+		fmt.Fprintf(bufferedOutput, "Target: %s\n", target.osPathname)
+		if err := showFinishedResults(bufferedOutput, runtimeStats); err != nil {
+			return 1
+		}
+		bufferedOutput.Flush()
+		addStats(&totalStats, runtimeStats)
+	}
+
+	fmt.Fprintf(bufferedOutput, "Total: %d targets\n", len(targets))
+	if err := showFinishedResults(bufferedOutput, totalStats); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// promoteProgram checks the --into targets and promotes the only
+// remaining argument, <desired_changes>, into each of them.
+func promoteProgram(opt *getoptions.GetOpt, remaining []string) int {
+	if len(remaining) != 1 {
+		fmt.Fprintf(os.Stderr, "ERROR: --into expects only <desired_changes> as an argument\n")
+		fmt.Fprint(os.Stderr, opt.Help(getoptions.HelpSynopsis))
+		return 2
+	}
+
+	sourceExt, err := statArgument(remaining[0])
+	if err != nil {
+		return argumentError(err)
+	}
+
+	targetNames, err := expandTargets(intoTargets, remaining[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Invalid --into: %s\n", err)
+		return 2
+	}
+	if len(targetNames) == 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: --into has no targets other than <desired_changes>\n")
+		return 2
+	}
+
+	targets := []fileInfoExtended{}
+	for _, targetName := range targetNames {
+		if targetName == stdinArgument {
+			fmt.Fprintf(os.Stderr, "ERROR: %s can only be used for <desired_changes>\n", stdinArgument)
+			return 2
+		}
+		target, err := statArgument(targetName)
+		if err != nil {
+			return argumentError(err)
+		}
+		if len(targets) == 0 {
+			// The first target decides if an archive is read as a directory, the others must match
+			sourceExt = openArchive(sourceExt, target)
+		}
+		target = openArchive(target, sourceExt)
+		if target.fileInfo.IsDir() != sourceExt.fileInfo.IsDir() {
+			fmt.Fprintf(os.Stderr, "ERROR: --into %s and %s must both be files or directories\n", targetName, remaining[0])
+			return 2
+		}
+		targets = append(targets, target)
+	}
+
+	return promoteWork(opt, sourceExt, targets)
+}
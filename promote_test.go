@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/DavidGamba/go-getoptions"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func Test_applyPromotedHunk(t *testing.T) {
+	hunk := promotedHunk{before: "a = 1\nb = 2\n", after: "a = 1\nb = 3\n"}
+	tests := []struct {
+		name   string
+		hunk   promotedHunk
+		text   string
+		want   string
+		wantOk bool
+	}{
+		{"Clean", hunk, "x = 0\na = 1\nb = 2\nc = 4\n", "x = 0\na = 1\nb = 3\nc = 4\n", true},
+		{"Start", hunk, "a = 1\nb = 2\n", "a = 1\nb = 3\n", true},
+		{"Changed", hunk, "a = 1\nb = 5\n", "a = 1\nb = 5\n", false},
+		{"Twice", hunk, "a = 1\nb = 2\na = 1\nb = 2\n", "a = 1\nb = 2\na = 1\nb = 2\n", false},
+		{"MidLine", hunk, "xa = 1\nb = 2\n", "xa = 1\nb = 2\n", false},
+		{"NoNewline", promotedHunk{before: "b = 2", after: "b = 3"}, "a = 1\nb = 2", "a = 1\nb = 3", true},
+		{"NoNewlineNotAtEnd", promotedHunk{before: "b = 2", after: "b = 3"}, "b = 2\n", "b = 2\n", false},
+		{"InsertAtStart", promotedHunk{before: "", after: "a = 1\n"}, "b = 2\n", "a = 1\nb = 2\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := applyPromotedHunk(tt.hunk, tt.text)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("applyPromotedHunk() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_expandTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		source   string
+		want     []string
+		wantErr  bool
+	}{
+		{"Plain", []string{"envs/qa", "envs/prod"}, "envs/dev", []string{"envs/qa", "envs/prod"}, false},
+		{"Repeated", []string{"envs/qa", "envs/qa/"}, "envs/dev", []string{"envs/qa"}, false},
+		{"Glob", []string{"testdata/same/*"}, "testdata/same/b", []string{"testdata/same/a"}, false},
+		{"NoMatch", []string{"testdata/fakedir/*"}, "testdata/same/b", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTargets(tt.patterns, tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expandTargets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_promoteWork(t *testing.T) {
+	defer func() { prompts = nil }()
+
+	tmpDir, err := ioutil.TempDir("", "promote")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	source := writeTestFile(filepath.Join(tmpDir, "dev/main.tf"), "env = \"dev\"\na = 1\nb = 2\nc = 3\nversion = \"5.0.8\"\nsize = \"small\"\n")
+	qa := writeTestFile(filepath.Join(tmpDir, "qa/main.tf"), "env = \"qa\"\na = 1\nb = 2\nc = 3\nversion = \"5.0.6\"\nsize = \"small\"\n")
+	prod := writeTestFile(filepath.Join(tmpDir, "prod/main.tf"), "env = \"prod\"\na = 1\nb = 2\nc = 3\nversion = \"5.0.6\"\nsize = \"small\"\n")
+	stage := writeTestFile(filepath.Join(tmpDir, "stage/main.tf"), "env = \"stage\"\na = 1\nb = 2\nc = 3\nversion = \"5.0.7\"\nsize = \"small\"\n")
+
+	// Review qa once, skip the env hunk and take the version hunk.
+	// prod reuses the selection, the version hunk does not apply cleanly to
+	// stage and is the only one reviewed again, the env hunk stays skipped.
+	setAnswers("y\nn\ny\ny\ny\n")
+
+	targets := []fileInfoExtended{loadTestFile(filepath.Dir(qa.osPathname)), loadTestFile(filepath.Dir(prod.osPathname)), loadTestFile(filepath.Dir(stage.osPathname))}
+	if got := promoteWork(getoptions.New(), loadTestFile(filepath.Dir(source.osPathname)), targets); got != 0 {
+		t.Errorf("promoteWork() = %v, want 0", got)
+	}
+	if promotedHunks != nil {
+		t.Errorf("promoteWork() left promotedHunks set")
+	}
+
+	want := map[string]string{
+		qa.osPathname:    "env = \"qa\"\na = 1\nb = 2\nc = 3\nversion = \"5.0.8\"\nsize = \"small\"\n",
+		prod.osPathname:  "env = \"prod\"\na = 1\nb = 2\nc = 3\nversion = \"5.0.8\"\nsize = \"small\"\n",
+		stage.osPathname: "env = \"stage\"\na = 1\nb = 2\nc = 3\nversion = \"5.0.8\"\nsize = \"small\"\n",
+	}
+	for fileName, content := range want {
+		got, _ := ioutil.ReadFile(fileName)
+		if string(got) != content {
+			t.Errorf("promoteWork() %s = %q, want %q", fileName, got, content)
+		}
+	}
+}
+
+func Test_promoteWorkNoContext(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer func() { diffContext = 1 }()
+	diffContext = 0
+
+	tmpDir, err := ioutil.TempDir("", "promote")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	source := writeTestFile(filepath.Join(tmpDir, "dev/main.tf"), "env = \"dev\"\na = 1\nb = 2\nd = 4\n")
+	qa := writeTestFile(filepath.Join(tmpDir, "qa/main.tf"), "env = \"qa\"\na = 1\nb = 2\n")
+	prod := writeTestFile(filepath.Join(tmpDir, "prod/main.tf"), "env = \"prod\"\na = 1\nb = 2\n")
+
+	// Review qa once, skip the env hunk and take the inserted line, prod
+	// reuses it anchored on the line before it
+	setAnswers("y\nn\ny\n")
+
+	targets := []fileInfoExtended{loadTestFile(filepath.Dir(qa.osPathname)), loadTestFile(filepath.Dir(prod.osPathname))}
+	if got := promoteWork(getoptions.New(), loadTestFile(filepath.Dir(source.osPathname)), targets); got != 0 {
+		t.Errorf("promoteWork() = %v, want 0", got)
+	}
+
+	want := map[string]string{
+		qa.osPathname:   "env = \"qa\"\na = 1\nb = 2\nd = 4\n",
+		prod.osPathname: "env = \"prod\"\na = 1\nb = 2\nd = 4\n",
+	}
+	for fileName, content := range want {
+		got, _ := ioutil.ReadFile(fileName)
+		if string(got) != content {
+			t.Errorf("promoteWork() %s = %q, want %q", fileName, got, content)
+		}
+	}
+}
+
+func Test_changedLinesB(t *testing.T) {
+	dmp := diffmatchpatch.New()
+	tests := []struct {
+		name      string
+		fileA     string
+		fileB     string
+		wantStart int
+		wantEnd   int
+	}{
+		{"Changed", "a\nb\nc\nd\n", "a\nb\nx\nd\n", 2, 3},
+		{"Inserted", "a\nb\nc\n", "a\nb\nx\ny\nc\n", 2, 4},
+		{"Deleted", "a\nb\nc\nd\n", "a\nb\nd\n", 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks := groupHunks(diffLineMode(dmp, tt.fileA, tt.fileB), 1)
+			if len(hunks) != 1 {
+				t.Fatalf("groupHunks() = %v hunks, want 1", len(hunks))
+			}
+			start, end := changedLinesB(hunks[0])
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("changedLinesB() = %v, %v, want %v, %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrorNoTerminal is returned when a question needs an answer and there is no terminal to ask.
+var ErrorNoTerminal = fmt.Errorf("no terminal to read answers from, use --default-answer yes or no to run without one")
+
+var defaultAnswers = []string{"fail", "yes", "no"}
+
+// prompter reads the answers to the questions asked while reviewing.
+type prompter interface {
+	readAnswer() (string, error)
+}
+
+// prompts answers every question, it is opened on the first question.
+// Tests set it to script the answers.
+var prompts prompter
+
+// readerPrompter reads one answer per line.
+type readerPrompter struct {
+	reader *bufio.Reader
+}
+
+func newReaderPrompter(reader io.Reader) *readerPrompter {
+	return &readerPrompter{reader: bufio.NewReader(reader)}
+}
+
+func (p *readerPrompter) readAnswer() (string, error) {
+	line, err := p.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// fixedPrompter gives the same answer to every question.
+type fixedPrompter struct {
+	answer string
+}
+
+func (p fixedPrompter) readAnswer() (string, error) {
+	fmt.Println(p.answer)
+	return p.answer, nil
+}
+
+// noTerminalPrompter fails every question.
+type noTerminalPrompter struct{}
+
+func (noTerminalPrompter) readAnswer() (string, error) {
+	return "", ErrorNoTerminal
+}
+
+// validDefaultAnswer reports if answer is a known --default-answer.
+func validDefaultAnswer(answer string) bool {
+	for _, known := range defaultAnswers {
+		if answer == known {
+			return true
+		}
+	}
+	return false
+}
+
+// openTerminal opens the controlling terminal, it fails when there is none.
+func openTerminal() (*os.File, error) {
+	return os.Open("/dev/tty")
+}
+
+// openPrompter reads answers from the terminal, so stdin can be redirected.
+// Without a terminal --default-answer answers every question or they fail.
+func openPrompter() prompter {
+	tty, err := openTerminal()
+	if err == nil {
+		return newReaderPrompter(tty)
+	}
+	logDebug("No terminal for prompts: " + err.Error())
+
+	switch defaultAnswer {
+	case "yes":
+		return fixedPrompter{answer: "y"}
+	case "no":
+		return fixedPrompter{answer: "n"}
+	}
+	return noTerminalPrompter{}
+}
+
+// readAnswer reads the answer to a question.
+func readAnswer() (string, error) {
+	if prompts == nil {
+		prompts = openPrompter()
+	}
+	answer, err := prompts.readAnswer()
+	if err != nil {
+		if err != ErrorNoTerminal {
+			err = fmt.Errorf("reading answer: %w", err)
+		}
+		logError("Error during confirmation", err)
+		fmt.Fprintln(os.Stderr)
+		return "", err
+	}
+	return answer, nil
+}
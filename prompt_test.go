@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// setAnswers scripts the answers to the next questions, one per line.
+func setAnswers(input string) {
+	prompts = newReaderPrompter(strings.NewReader(input))
+}
+
+func Test_readerPrompter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		err   error
+	}{
+		{"Lines", "y\n n \n", []string{"y", "n"}, io.EOF},
+		{"MissingLastNewline", "y\nq", []string{"y", "q"}, io.EOF},
+		{"Empty", "\n", []string{""}, io.EOF},
+		{"NoInput", "", []string{}, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newReaderPrompter(strings.NewReader(tt.input))
+			for _, want := range tt.want {
+				got, err := p.readAnswer()
+				if err != nil || got != want {
+					t.Errorf("readAnswer() = %q, %v, want %q", got, err, want)
+				}
+			}
+			if _, err := p.readAnswer(); !errors.Is(err, tt.err) {
+				t.Errorf("readAnswer() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func Test_openPrompter(t *testing.T) {
+	defer func() { defaultAnswer = "fail" }()
+	defer func() { prompts = nil }()
+
+	if _, err := openTerminal(); err == nil {
+		t.Skip("a terminal is available")
+	}
+
+	tests := []struct {
+		name          string
+		defaultAnswer string
+		want          bool
+		err           error
+	}{
+		{"Fail", "fail", false, ErrorNoTerminal},
+		{"Yes", "yes", true, nil},
+		{"No", "no", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultAnswer = tt.defaultAnswer
+			prompts = nil
+			got, err := askForConfirmation()
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("askForConfirmation() = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func Test_compareFilesNoTerminal(t *testing.T) {
+	defer func() { prompts = nil }()
+
+	// The review stops at the first question instead of skipping every hunk
+	prompts = noTerminalPrompter{}
+	fileA := loadTestFile("testdata/smalldiff/t1.txt")
+	fileB := loadTestFile("testdata/smalldiff/t2.txt")
+	_, err := compareFiles(fileA, fileB, true, false)
+	if !errors.Is(err, ErrorNoTerminal) {
+		t.Errorf("compareFiles() error = %v, want %v", err, ErrorNoTerminal)
+	}
+}
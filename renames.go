@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gookit/color"
+)
+
+// renamePair is a file only found in <original> that is similar enough
+// to a file only found in <desired_changes> to be treated as a move.
+type renamePair struct {
+	original   fileInfoExtended
+	desired    fileInfoExtended
+	target     string // where the original file moves to
+	similarity int    // percentage of content in common
+}
+
+// findRenames pairs up files that only exist on one side by content,
+// exact copies first and then the most similar files at or above threshold percent.
+// Every file is used in at most one pair.
+func findRenames(onlyOriginal []fileInfoExtended, onlyDesired []fileInfoExtended, threshold int) []renamePair {
+	pairs := []renamePair{}
+	if threshold <= 0 || len(onlyOriginal) == 0 || len(onlyDesired) == 0 {
+		return pairs
+	}
+
+	originalContent := readRenameCandidates(onlyOriginal, false)
+	desiredContent := readRenameCandidates(onlyDesired, true)
+
+	candidates := []renamePair{}
+	candidateIndex := [][2]int{}
+
+	// Exact matches by hash
+	desiredHashes := make(map[[sha1.Size]byte][]int)
+	for j, content := range desiredContent {
+		if content == nil {
+			continue
+		}
+		hash := sha1.Sum(content)
+		desiredHashes[hash] = append(desiredHashes[hash], j)
+	}
+	for i, content := range originalContent {
+		if len(content) == 0 {
+			continue
+		}
+		for _, j := range desiredHashes[sha1.Sum(content)] {
+			candidates = append(candidates, renamePair{original: onlyOriginal[i], desired: onlyDesired[j], similarity: 100})
+			candidateIndex = append(candidateIndex, [2]int{i, j})
+		}
+	}
+
+	// Similar content, only files sharing at least one line are measured
+	desiredLines := make([]fileLines, len(desiredContent))
+	for j, content := range desiredContent {
+		desiredLines[j] = countLines(content)
+	}
+	index := newLineIndex(desiredLines)
+	for i, contentA := range originalContent {
+		linesA := countLines(contentA)
+		shared := sharedBytes(linesA, index)
+		matches := []int{}
+		for j := range shared {
+			matches = append(matches, j)
+		}
+		sort.Ints(matches)
+		for _, j := range matches {
+			contentB := desiredContent[j]
+			if !similarSize(len(contentA), len(contentB), threshold) || bytes.Equal(contentA, contentB) {
+				continue
+			}
+			score := similarity(shared[j], len(contentA), len(contentB))
+			if score >= threshold {
+				candidates = append(candidates, renamePair{original: onlyOriginal[i], desired: onlyDesired[j], similarity: score})
+				candidateIndex = append(candidateIndex, [2]int{i, j})
+			}
+		}
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(x, y int) bool {
+		return candidates[order[x]].similarity > candidates[order[y]].similarity
+	})
+
+	usedOriginal := make(map[int]bool)
+	usedDesired := make(map[int]bool)
+	for _, c := range order {
+		i, j := candidateIndex[c][0], candidateIndex[c][1]
+		if usedOriginal[i] || usedDesired[j] {
+			continue
+		}
+		usedOriginal[i] = true
+		usedDesired[j] = true
+		pairs = append(pairs, candidates[c])
+	}
+
+	return pairs
+}
+
+// similarSize reports if two files are close enough in size to reach threshold.
+func similarSize(sizeA int, sizeB int, threshold int) bool {
+	if sizeA == 0 || sizeB == 0 {
+		return false
+	}
+	small, large := sizeA, sizeB
+	if small > large {
+		small, large = large, small
+	}
+	return small*100 >= large*threshold
+}
+
+// readRenameCandidates reads the files only found on one side, a file that
+// can not be read is left out of rename detection with a nil content. The
+// content is normalised the way files are compared, substitutions rewrite
+// <desired_changes> only.
+func readRenameCandidates(files []fileInfoExtended, desired bool) [][]byte {
+	contents := make([][]byte, len(files))
+	for i, fileExtInfo := range files {
+		content, err := readFileContent(fileExtInfo)
+		if err != nil {
+			logError("Reading file for rename detection failed", err)
+			fmt.Fprintln(os.Stderr)
+			continue
+		}
+		text := string(content)
+		if desired && len(substitutions) > 0 {
+			text = substitute(text, substitutions)
+		}
+		contents[i] = []byte(normalizeLines(text))
+	}
+	return contents
+}
+
+// fileLines counts how often every line occurs in a file.
+type fileLines map[string]int
+
+func countLines(content []byte) fileLines {
+	lines := fileLines{}
+	for _, line := range splitLinesKeepEnds(string(content)) {
+		lines[line]++
+	}
+	return lines
+}
+
+// lineCount is how often a line occurs in one of the indexed files.
+type lineCount struct {
+	file  int
+	count int
+}
+
+// newLineIndex maps every line to the files holding it.
+func newLineIndex(files []fileLines) map[string][]lineCount {
+	index := make(map[string][]lineCount)
+	for i, lines := range files {
+		for line, count := range lines {
+			index[line] = append(index[line], lineCount{file: i, count: count})
+		}
+	}
+	return index
+}
+
+// sharedBytes returns the bytes in lines a shares with every indexed
+// file it has lines in common with, a repeated line is shared as often as
+// it occurs in both.
+func sharedBytes(a fileLines, index map[string][]lineCount) map[int]int {
+	shared := make(map[int]int)
+	for line, countA := range a {
+		for _, b := range index[line] {
+			count := countA
+			if b.count < count {
+				count = b.count
+			}
+			shared[b.file] += count * len(line)
+		}
+	}
+	return shared
+}
+
+// similarity returns the percentage of bytes in shared lines, measured
+// against the larger file like git's rename detection.
+func similarity(shared int, sizeA int, sizeB int) int {
+	size := sizeA
+	if sizeB > size {
+		size = sizeB
+	}
+	if size == 0 {
+		return 0
+	}
+	return shared * 100 / size
+}
+
+// handleRename offers to move the original file to the path used in
+// <desired_changes> and then reviews the remaining differences as usual.
+func handleRename(rename renamePair, dryRun bool, reportOnly bool) error {
+	if reportOnly {
+		countStats(func(stats *trackedStats) { stats.FilesRenamed++ })
+		fmt.Printf("Files %s and %s renamed, similarity %d%%\n", rename.original.osPathname, rename.desired.osPathname, rename.similarity)
+		return nil
+	}
+
+	color.Style{color.OpBold}.Printf("Rename detected: %s -> %s, similarity %d%%, from: %s\n", rename.original.osPathname, rename.target, rename.similarity, rename.desired.osPathname)
+	color.Style{color.Blue, color.OpBold}.Print("Move file and review patches [y,n,q]? ")
+	move, err := askForConfirmation()
+	if err != nil {
+		return err
+	}
+	if !move {
+		return nil
+	}
+	if !rename.original.readOnly && !dryRun {
+		if err := checkDirty(rename.original); err != nil {
+			return skipDirty(err)
+		}
+	}
+	countStats(func(stats *trackedStats) { stats.FilesRenamed++ })
+
+	moved := rename.original
+	if rename.original.readOnly {
+		fmt.Printf("Read only, skipping move: %s\n", rename.original.osPathname)
+	} else if dryRun {
+		fmt.Printf("Dry-run enabled, skipping move: %s\n", rename.original.osPathname)
+	} else {
+		if _, err := os.Stat(rename.target); err == nil {
+			return fmt.Errorf("refusing to move, file exists: %s", rename.target)
+		}
+		if err := os.MkdirAll(filepath.Dir(rename.target), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(rename.original.osPathname, rename.target); err != nil {
+			return err
+		}
+		if err := stageFile(rename.original.osPathname); err != nil {
+			return err
+		}
+		if err := stageFile(rename.target); err != nil {
+			return err
+		}
+		moved.osPathname = rename.target
+	}
+
+	_, err = compareFiles(moved, rename.desired, dryRun, reportOnly)
+	return err
+}
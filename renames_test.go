@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(fileName string, content string) fileInfoExtended {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		log.Fatal(err)
+	}
+	return loadTestFile(fileName)
+}
+
+func Test_similarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want int
+	}{
+		{"Same", "a\nb\n", "a\nb\n", 100},
+		{"Half", "a\nb\n", "a\nc\n", 50},
+		{"Nothing", "a\nb\n", "c\nd\n", 0},
+		{"Reordered", "a\nb\n", "b\na\n", 100},
+		{"Repeated", "a\na\na\nb\n", "a\nb\nb\nb\n", 50},
+		{"Empty", "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newLineIndex([]fileLines{countLines([]byte(tt.b))})
+			shared := sharedBytes(countLines([]byte(tt.a)), index)
+			if got := similarity(shared[0], len(tt.a), len(tt.b)); got != tt.want {
+				t.Errorf("similarity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findRenames(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "renames")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	module := "variable \"a\" {}\nvariable \"b\" {}\nvariable \"c\" {}\nvariable \"d\" {}\n"
+	origExact := writeTestFile(filepath.Join(tmpDir, "a/modules/one/exact.tf"), module)
+	origSimilar := writeTestFile(filepath.Join(tmpDir, "a/modules/one/similar.tf"), module+"output \"x\" {}\n")
+	origOther := writeTestFile(filepath.Join(tmpDir, "a/other.tf"), "locals {}\n")
+	desiredExact := writeTestFile(filepath.Join(tmpDir, "b/modules/two/exact.tf"), module)
+	desiredSimilar := writeTestFile(filepath.Join(tmpDir, "b/modules/two/similar.tf"), module+"output \"y\" {}\n")
+	desiredOther := writeTestFile(filepath.Join(tmpDir, "b/unrelated.tf"), "terraform {}\n")
+
+	// Removed after the trees were listed, it is left out
+	origGone := fileInfoExtended{osPathname: filepath.Join(tmpDir, "a/gone.tf")}
+	onlyOriginal := []fileInfoExtended{origExact, origGone, origSimilar, origOther}
+	onlyDesired := []fileInfoExtended{desiredOther, desiredSimilar, desiredExact}
+
+	tests := []struct {
+		name      string
+		threshold int
+		want      map[string]string
+	}{
+		{"Disabled", 0, map[string]string{}},
+		{"Half", 50, map[string]string{origExact.osPathname: desiredExact.osPathname, origSimilar.osPathname: desiredSimilar.osPathname}},
+		{"ExactOnly", 100, map[string]string{origExact.osPathname: desiredExact.osPathname}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findRenames(onlyOriginal, onlyDesired, tt.threshold)
+			if len(got) != len(tt.want) {
+				t.Errorf("findRenames() = %v pairs, want %v", len(got), len(tt.want))
+				return
+			}
+			for _, pair := range got {
+				if tt.want[pair.original.osPathname] != pair.desired.osPathname {
+					t.Errorf("findRenames() paired %v with %v", pair.original.osPathname, pair.desired.osPathname)
+				}
+			}
+		})
+	}
+}
+
+func Test_findRenamesNormalized(t *testing.T) {
+	defer func() { substitutions, ignoreCase, ignoreAllSpace = nil, false, false }()
+
+	tmpDir, err := ioutil.TempDir("", "renames")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	original := writeTestFile(filepath.Join(tmpDir, "a/main.tf"), "Region = \"eu-west-1\"\nZone = \"a\"\n")
+	desired := writeTestFile(filepath.Join(tmpDir, "b/site.tf"), "region=\"us-east-1\"\nzone=\"a\"\n")
+
+	tests := []struct {
+		name  string
+		rules []string
+		flags bool
+		want  int
+	}{
+		{"Raw", nil, false, 0},
+		{"SubstitutionOnly", []string{"us-east-1=eu-west-1"}, false, 0},
+		{"Normalized", []string{"us-east-1=eu-west-1"}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			substitutions, _ = parseSubstitutions(tt.rules)
+			ignoreCase, ignoreAllSpace = tt.flags, tt.flags
+			if got := findRenames([]fileInfoExtended{original}, []fileInfoExtended{desired}, 100); len(got) != tt.want {
+				t.Errorf("findRenames() = %v pairs, want %v", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_handleRename(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer func(stats trackedStats) { runtimeStats = stats }(runtimeStats)
+
+	tmpDir, err := ioutil.TempDir("", "renames")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	original := writeTestFile(filepath.Join(tmpDir, "a/old/main.tf"), "a = 1\nb = 2\nc = 3\n")
+	desired := writeTestFile(filepath.Join(tmpDir, "b/new/main.tf"), "a = 1\nb = 2\nc = 3\n")
+	target := filepath.Join(tmpDir, "a/new/main.tf")
+
+	tests := []struct {
+		name       string
+		input      string
+		dryRun     bool
+		reportOnly bool
+		wantMoved  bool
+		wantCount  int
+	}{
+		{"ReportOnly", "", false, true, false, 1},
+		{"DryRun", "y", true, false, false, 1},
+		{"Declined", "n", false, false, false, 0},
+		{"Moved", "y", false, false, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAnswers(tt.input)
+			runtimeStats = trackedStats{}
+
+			rename := renamePair{original: original, desired: desired, target: target, similarity: 100}
+			if err := handleRename(rename, tt.dryRun, tt.reportOnly); err != nil {
+				t.Errorf("handleRename() error = %v", err)
+			}
+			_, err = os.Stat(target)
+			if moved := err == nil; moved != tt.wantMoved {
+				t.Errorf("handleRename() moved = %v, want %v", moved, tt.wantMoved)
+			}
+			if runtimeStats.FilesRenamed != tt.wantCount {
+				t.Errorf("handleRename() FilesRenamed = %v, want %v", runtimeStats.FilesRenamed, tt.wantCount)
+			}
+		})
+	}
+}
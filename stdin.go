@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/DavidGamba/go-getoptions"
+	"github.com/DavidGamba/go-getoptions/option"
+)
+
+// stdinArgument reads <desired_changes> from stdin.
+const stdinArgument = "-"
+
+// stdinMarker stands in for stdinArgument while parsing the command line,
+// getoptions takes a lone dash as an option. Arguments can not hold a NUL.
+const stdinMarker = "\x00stdin"
+
+// optionNames matches the option names listed by GetOpt.Stringer.
+var optionNames = regexp.MustCompile(`(?m)^"([^"]+)":`)
+
+// valueOptions returns the names and aliases of the options that take a value.
+func valueOptions(opt *getoptions.GetOpt) map[string]bool {
+	aliases := map[string]bool{}
+	for _, match := range optionNames.FindAllStringSubmatch(opt.Stringer(), -1) {
+		valueOption := opt.Option(match[1])
+		if valueOption == nil || valueOption.OptType == option.BoolType {
+			continue
+		}
+		for _, alias := range valueOption.Aliases {
+			aliases[alias] = true
+		}
+	}
+	return aliases
+}
+
+// hideStdinArguments replaces a positional stdinArgument with stdinMarker up
+// to a "--". A dash given as the value of an option is joined to the option
+// instead, so the option gets it as is.
+func hideStdinArguments(opt *getoptions.GetOpt, args []string) []string {
+	aliases := valueOptions(opt)
+	hidden := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			hidden = append(hidden, args[i:]...)
+			break
+		}
+		if arg == stdinArgument {
+			hidden = append(hidden, stdinMarker)
+			continue
+		}
+		alias := strings.TrimLeft(arg, "-")
+		if alias != arg && aliases[alias] && i+1 < len(args) && args[i+1] == stdinArgument {
+			hidden = append(hidden, arg+"="+stdinArgument)
+			i++
+			continue
+		}
+		hidden = append(hidden, arg)
+	}
+	return hidden
+}
+
+// showStdinArguments puts stdinArgument back in place of stdinMarker.
+func showStdinArguments(args []string) []string {
+	for i, arg := range args {
+		if arg == stdinMarker {
+			args[i] = stdinArgument
+		}
+	}
+	return args
+}
+
+// statStream reads stdin or a pipe such as <(terraform fmt -) into memory,
+// it can only be read once so the content is kept and never written.
+func statStream(arg string, stream io.Reader) (fileInfoExtended, error) {
+	content, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return fileInfoExtended{osPathname: arg}, err
+	}
+	if content == nil {
+		content = []byte{}
+	}
+
+	return fileInfoExtended{
+		osPathname: arg,
+		fileInfo:   virtualFileInfo{name: filepath.Base(arg), size: int64(len(content))},
+		memContent: content,
+		readOnly:   true,
+	}, nil
+}
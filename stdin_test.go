@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DavidGamba/go-getoptions"
+)
+
+func Test_hideStdinArguments(t *testing.T) {
+	opt := getoptions.New()
+	opt.Bool("quiet", false, opt.Alias("q"))
+	opt.StringSlice("ignore-matching-lines", 1, 1, opt.Alias("I"))
+
+	tests := []struct {
+		name      string
+		args      []string
+		want      []string
+		wantShown []string
+	}{
+		{"None", []string{"a", "b"}, []string{"a", "b"}, []string{"a", "b"}},
+		{"Desired", []string{"-q", "a", "-"}, []string{"-q", "a", stdinMarker}, []string{"-q", "a", "-"}},
+		{"AfterDashes", []string{"a", "--", "-"}, []string{"a", "--", "-"}, []string{"a", "--", "-"}},
+		{"OptionValue", []string{"-I", "-", "a", "-"}, []string{"-I=-", "a", stdinMarker}, []string{"-I=-", "a", "-"}},
+		{"LongOptionValue", []string{"--ignore-matching-lines", "-", "a", "b"}, []string{"--ignore-matching-lines=-", "a", "b"}, []string{"--ignore-matching-lines=-", "a", "b"}},
+		{"BoolOption", []string{"-q", "-"}, []string{"-q", stdinMarker}, []string{"-q", "-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hideStdinArguments(opt, tt.args)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hideStdinArguments() = %q, want %q", got, tt.want)
+			}
+			if shown := showStdinArguments(got); !reflect.DeepEqual(shown, tt.wantShown) {
+				t.Errorf("showStdinArguments() = %q, want %q", shown, tt.wantShown)
+			}
+		})
+	}
+}
+
+func Test_statStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"Empty", ""},
+		{"Content", "version = \"5.0.8\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := statStream("/dev/fd/63", strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("statStream() error = %v", err)
+			}
+			if got.memContent == nil || string(got.memContent) != tt.content {
+				t.Errorf("statStream() content = %q, want %q", got.memContent, tt.content)
+			}
+			if !got.readOnly || got.fileInfo.IsDir() || got.fileInfo.Size() != int64(len(tt.content)) {
+				t.Errorf("statStream() = %+v, want a read only file of %v bytes", got, len(tt.content))
+			}
+		})
+	}
+}
+
+func Test_compareFilesStdin(t *testing.T) {
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	defer func() { prompts = nil }()
+
+	stdinFile, err := ioutil.TempFile("", "utesttmp.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(stdinFile.Name())
+	updateStdInContent(stdinFile, "version = \"5.0.8\"\n")
+	os.Stdin = stdinFile
+
+	desired, err := statArgument(stdinArgument)
+	if err != nil {
+		t.Fatalf("statArgument() error = %v", err)
+	}
+
+	// Answers never come from stdin, it holds the desired changes
+	setAnswers("y\ny\n")
+	tmpDir, err := ioutil.TempDir("", "stdin")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	original := writeTestFile(tmpDir+"/main.tf", "version = \"5.0.6\"\n")
+
+	equal, err := compareFiles(original, desired, false, false)
+	if err != nil || equal {
+		t.Errorf("compareFiles() = %v, %v, want false", equal, err)
+	}
+	content, _ := ioutil.ReadFile(original.osPathname)
+	if string(content) != "version = \"5.0.8\"\n" {
+		t.Errorf("compareFiles() = %q, want the content from stdin", content)
+	}
+}
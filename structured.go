@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gookit/color"
+)
+
+// structChangeKind tells if a key was changed, added or removed.
+type structChangeKind int
+
+const (
+	keyChanged structChangeKind = iota
+	keyAdded
+	keyRemoved
+)
+
+// structChange is a change to one key path of a structured file such as YAML.
+// It is applied by replacing original[start:end] with text, so the rest of
+// the original keeps its comments and formatting.
+type structChange struct {
+	kind   structChangeKind
+	path   string
+	before string // value in the original
+	after  string // value in the desired changes
+	start  int
+	end    int
+	text   string
+	line   *lineDiff // the hunk behind a change found by the line comparator
+}
+
+// String shows the change the way it is reviewed, spec.replicas: 2 → 3.
+func (c structChange) String() string {
+	if !strings.Contains(c.before+c.after, "\n") {
+		switch c.kind {
+		case keyAdded:
+			return color.Style{color.Green}.Sprintf("+ %s: %s", c.path, c.after) + "\n"
+		case keyRemoved:
+			return color.Style{color.Red}.Sprintf("- %s: %s", c.path, c.before) + "\n"
+		}
+		return fmt.Sprintf("%s: %s → %s\n", c.path, color.Style{color.Red}.Sprint(c.before), color.Style{color.Green}.Sprint(c.after))
+	}
+
+	out := c.path + ":\n"
+	if c.kind != keyAdded {
+		out += colorChange(prefixLines(c.before, "- "), color.Red, color.BgRed)
+	}
+	if c.kind != keyRemoved {
+		out += colorChange(prefixLines(c.after, "+ "), color.Green, color.BgGreen)
+	}
+	return out
+}
+
+// prefixLines puts prefix in front of every line of text and ends it with a newline.
+func prefixLines(text string, prefix string) string {
+	out := ""
+	for _, line := range splitLinesKeepEnds(text) {
+		out += prefix + line
+	}
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return out
+}
+
+// lineIndent returns the white space at the start of the line holding offset.
+func lineIndent(text string, offset int) string {
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+	line := text[start:offset]
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// structFormat compares and patches one type of structured file.
+type structFormat struct {
+	name   string
+	globs  []string
+	diff   func(textA string, textB string) ([]structChange, bool)
+	finish func(text string) string                       // tidies the text once changes are applied, optional
+	record func(fileName string, accepted []structChange) // keeps the changes accepted for a file, optional
+}
+
+func (f *structFormat) Name() string {
+	return f.name
+}
+
+func (f *structFormat) Detect(fileName string, head []byte) bool {
+	return matchGlobs(f.globs, fileName)
+}
+
+func (f *structFormat) Diff(textA string, textB string) ([]structChange, bool) {
+	return f.diff(textA, textB)
+}
+
+func (f *structFormat) Apply(textA string, selected []structChange) (string, error) {
+	text := applyStructChanges(textA, selected)
+	if f.finish != nil && len(selected) > 0 {
+		text = f.finish(text)
+	}
+	return text, nil
+}
+
+func (f *structFormat) Record(fileName string, accepted []structChange) {
+	if f.record != nil {
+		f.record(fileName, accepted)
+	}
+}
+
+// applyStructChanges applies changes to text, they must not overlap. A change
+// that removes text is applied before one that inserts at the same offset,
+// and inserts at the same offset keep the order of changes.
+func applyStructChanges(text string, changes []structChange) string {
+	sorted := append([]structChange{}, changes...)
+	for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+		sorted[i], sorted[j] = sorted[j], sorted[i]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].start != sorted[j].start {
+			return sorted[i].start > sorted[j].start
+		}
+		return sorted[i].end > sorted[j].end
+	})
+	for _, change := range sorted {
+		text = text[:change.start] + change.text + text[change.end:]
+	}
+	return text
+}
+
+// compileKeyPatterns turns --ignore-key patterns into regular expressions,
+// * matches any text and the rest is literal.
+func compileKeyPatterns(patterns []string) []*regexp.Regexp {
+	regexps := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		parts := strings.Split(pattern, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		regexps = append(regexps, regexp.MustCompile("^"+strings.Join(parts, ".*")+"$"))
+	}
+	return regexps
+}
+
+// ignoredKey reports if changes to a key path are ignored by --ignore-key.
+func ignoredKey(path string) bool {
+	for _, re := range ignoreKeyRegexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// reviewStructChanges is createDiffs for the changes of a Comparator, every
+// change is reviewed on its own and the selected ones are applied to the original.
+func reviewStructChanges(comparator Comparator, fileAExt fileInfoExtended, fileBExt fileInfoExtended, changes []structChange) (fileDiffInfo, error) {
+	fileDiffInfo := fileDiffInfo{diffCount: len(changes)}
+	selected := []structChange{}
+	if r, ok := comparator.(recorder); ok {
+		defer func() { r.Record(fileAExt.osPathname, selected) }()
+	}
+
+	if len(changes) == 0 {
+		if len(ignoreKeyRegexps) > 0 {
+			fmt.Printf("Only formatting, comments, key order or ignored keys differ: %s, %s\n", fileAExt.osPathname, fileBExt.osPathname)
+			return fileDiffInfo, nil
+		}
+		fmt.Printf("Only formatting, comments or key order differ: %s, %s\n", fileAExt.osPathname, fileBExt.osPathname)
+		return fileDiffInfo, nil
+	}
+
+	summary := ""
+	for _, change := range changes {
+		summary += change.String()
+	}
+	lookAtPatches, err := reviewDiff(summary, fileAExt.osPathname, fileBExt.osPathname, fileAExt.autoPatch)
+	if err != nil || !lookAtPatches {
+		return fileDiffInfo, err
+	}
+
+	for _, change := range changes {
+		color.Style{color.OpBold}.Printf("Appling change to: %s\n", fileAExt.osPathname)
+		fmt.Print(change.String())
+		if fileAExt.autoPatch {
+			fmt.Print("Apply change [y,n,q]? AutoAppling\n")
+			selected = append(selected, change)
+			continue
+		}
+		color.Style{color.Blue, color.OpBold}.Print("Apply change [y,n,q]? ")
+		apply, err := askForConfirmation()
+		if err != nil {
+			return fileDiffInfo, err
+		}
+		if apply {
+			selected = append(selected, change)
+		}
+	}
+
+	fileDiffInfo.patchesTotal = len(selected)
+	newText, err := comparator.Apply(fileAExt.fileContentString, selected)
+	if err != nil {
+		fileDiffInfo.patchesFailed = len(selected)
+		return fileDiffInfo, err
+	}
+	fileDiffInfo.patchesApplied = len(selected)
+	if newText != fileAExt.fileContentString {
+		fileDiffInfo.patched = true
+		fileDiffInfo.newContent = []byte(newText)
+	}
+
+	fmt.Printf("\nChanges: %v, Applied: %v\n", len(changes), len(selected))
+	return fileDiffInfo, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// substitution rewrites environment specific values in <desired_changes>
+// to the values used in <original>.
+type substitution struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// parseSubstitutions parses --substitute rules in the form pattern=replacement.
+// The pattern is a regular expression and the replacement may refer to
+// capture groups with $1 or ${name}.
+func parseSubstitutions(rules []string) ([]substitution, error) {
+	substitutions := []substitution{}
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("expected pattern=replacement, got: %s", rule)
+		}
+		pattern, err := regexp.Compile(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		substitutions = append(substitutions, substitution{pattern: pattern, replacement: parts[1]})
+	}
+	return substitutions, nil
+}
+
+// substitute applies every substitution to text in order.
+func substitute(text string, substitutions []substitution) string {
+	for _, sub := range substitutions {
+		text = sub.pattern.ReplaceAllString(text, sub.replacement)
+	}
+	return text
+}
+
+// applySubstitutions rewrites the loaded content of a file from <desired_changes>,
+// so the substituted values are both compared and written into <original>.
+func applySubstitutions(fileX *fileInfoExtended) {
+	if len(substitutions) == 0 {
+		return
+	}
+	fileX.fileContentString = substitute(fileX.fileContentString, substitutions)
+	fileX.fileContent = []byte(fileX.fileContentString)
+	fileX.substituted = true
+}
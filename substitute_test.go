@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_parseSubstitutions(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		wantLen int
+		wantErr bool
+	}{
+		{"Empty", []string{}, 0, false},
+		{"Valid", []string{"dev=prod", `(\d{12})=111111111111`}, 2, false},
+		{"EmptyReplacement", []string{"-dev="}, 1, false},
+		{"MissingEquals", []string{"dev"}, 0, true},
+		{"MissingPattern", []string{"=prod"}, 0, true},
+		{"BadPattern", []string{"(dev=prod"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSubstitutions(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSubstitutions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.wantLen {
+				t.Errorf("parseSubstitutions() = %v, want %v substitutions", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func Test_substitute(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		text  string
+		want  string
+	}{
+		{"None", nil, "env = dev", "env = dev"},
+		{"Literal", []string{"dev=prod"}, "env = dev\nname = dev-app", "env = prod\nname = prod-app"},
+		{"Regex", []string{`"\d{12}"="111111111111"`}, `account = "222222222222"`, `account = "111111111111"`},
+		{"Groups", []string{`acme-(\w+)-logs=logs-$1`}, "acme-dev-logs", "logs-dev"},
+		{"InOrder", []string{"dev=qa", "qa=prod"}, "dev", "prod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			substitutions, _ := parseSubstitutions(tt.rules)
+			if got := substitute(tt.text, substitutions); got != tt.want {
+				t.Errorf("substitute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compareFilesSubstitute(t *testing.T) {
+	defer func() { substitutions = nil }()
+
+	fileA := loadTestFile("testdata/substitute/prod.tf")
+	fileB := loadTestFile("testdata/substitute/dev.tf")
+
+	tests := []struct {
+		name  string
+		rules []string
+		want  bool
+	}{
+		{"NoSubstitutions", nil, false},
+		{"Partial", []string{"dev=prod"}, false},
+		{"All", []string{"dev=prod", "222222222222=111111111111"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			substitutions, _ = parseSubstitutions(tt.rules)
+			got, err := compareFiles(fileA, fileB, true, true)
+			if err != nil {
+				t.Errorf("compareFiles() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("compareFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compareFilesReverseSubstitute(t *testing.T) {
+	defer func() { substitutions = nil }()
+	defer func() { prompts = nil }()
+
+	tests := []struct {
+		name  string
+		input string
+		wantA string
+		wantB string
+	}{
+		{"Forward", "y\ny\n", "name = prod-a\nsize = 2\n", "name = dev-a\nsize = 2\n"},
+		{"Answer", "r\ny\ny\n", "name = prod-a\nsize = 1\n", "name = prod-a\nsize = 1\n"},
+		{"AnswerTwice", "r\nr\ny\ny\n", "name = prod-a\nsize = 2\n", "name = dev-a\nsize = 2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "substitute")
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+			fileA := writeTestFile(filepath.Join(tmpDir, "prod.txt"), "name = prod-a\nsize = 1\n")
+			fileB := writeTestFile(filepath.Join(tmpDir, "dev.txt"), "name = dev-a\nsize = 2\n")
+
+			setAnswers(tt.input)
+			substitutions, _ = parseSubstitutions([]string{"dev=prod"})
+			if _, err := compareFiles(fileA, fileB, false, false); err != nil {
+				t.Errorf("compareFiles() error = %v", err)
+			}
+
+			gotA, _ := ioutil.ReadFile(fileA.osPathname)
+			gotB, _ := ioutil.ReadFile(fileB.osPathname)
+			if string(gotA) != tt.wantA || string(gotB) != tt.wantB {
+				t.Errorf("compareFiles() = %q, %q, want %q, %q", gotA, gotB, tt.wantA, tt.wantB)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+module "redis" {
+  node_type = "cache.m5.large"
+}
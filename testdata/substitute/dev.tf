@@ -0,0 +1,3 @@
+bucket = "acme-dev-logs"
+account = "222222222222"
+env = "dev"
@@ -0,0 +1,3 @@
+bucket = "acme-prod-logs"
+account = "111111111111"
+env = "prod"
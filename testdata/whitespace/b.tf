@@ -0,0 +1,6 @@
+module "redis" {
+  node_type      = "cache.t3.small"
+  engine_version = "5.0.6"
+  tags           = local.common_tags  
+
+}
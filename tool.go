@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ErrorTool is returned when the user decides to resolve the file in the --tool instead.
+var ErrorTool = fmt.Errorf("opened in tool by user")
+
+// mergeTools are the tools --tool knows by name. In a command $ORIGINAL and
+// $DESIRED are replaced by the paths of the files, a command using $RESULT
+// is a three-way merge writing the result there instead of into <original>.
+var mergeTools = map[string]string{
+	"meld":    "meld $ORIGINAL $DESIRED",
+	"vimdiff": "vimdiff $ORIGINAL $DESIRED",
+	"code":    "code --wait --diff $ORIGINAL $DESIRED",
+}
+
+// parseMergeTool returns the command of a --tool, a known name or a command line.
+func parseMergeTool(tool string) ([]string, error) {
+	if known, ok := mergeTools[tool]; ok {
+		tool = known
+	}
+	command := strings.Fields(tool)
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command given")
+	}
+	if !strings.Contains(tool, "$ORIGINAL") && !strings.Contains(tool, "$DESIRED") && !strings.Contains(tool, "$RESULT") {
+		command = append(command, "$ORIGINAL", "$DESIRED")
+	}
+	return command, nil
+}
+
+// toolCopy writes content for the tool to a file named like the original
+// one, so the tool can still show the name and highlight the syntax.
+func toolCopy(tmpDir string, side string, fileName string, content []byte) (string, error) {
+	copyPath := filepath.Join(tmpDir, side, filepath.Base(fileName))
+	if err := os.MkdirAll(filepath.Dir(copyPath), 0755); err != nil {
+		return "", err
+	}
+	return copyPath, ioutil.WriteFile(copyPath, content, 0644)
+}
+
+// runMergeTool opens the files in the --tool and waits for it to exit.
+// A two-way tool edits <original> in place, a three-way tool edits a copy
+// given as $RESULT. Files that are not on disk, or not to be written with
+// --dry-run, are handed to the tool as copies. Both files are reloaded.
+func runMergeTool(fileAExt *fileInfoExtended, fileBExt *fileInfoExtended, dryRun bool) error {
+	tmpDir, err := ioutil.TempDir("", "dap-tool")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	threeWay := strings.Contains(strings.Join(mergeToolCommand, " "), "$RESULT")
+	originalPath := fileAExt.osPathname
+	if fileAExt.readOnly || (dryRun && !threeWay) {
+		if originalPath, err = toolCopy(tmpDir, "original", fileAExt.osPathname, fileAExt.fileContent); err != nil {
+			return err
+		}
+	}
+	desiredPath := fileBExt.osPathname
+	if fileBExt.readOnly || len(substitutions) > 0 {
+		// Substitutions only apply to the content in memory
+		if desiredPath, err = toolCopy(tmpDir, "desired", fileBExt.osPathname, fileBExt.fileContent); err != nil {
+			return err
+		}
+	}
+	resultPath := originalPath
+	if threeWay {
+		if resultPath, err = toolCopy(tmpDir, "result", fileAExt.osPathname, fileAExt.fileContent); err != nil {
+			return err
+		}
+	}
+
+	args := []string{}
+	for _, arg := range mergeToolCommand {
+		arg = strings.ReplaceAll(arg, "$ORIGINAL", originalPath)
+		arg = strings.ReplaceAll(arg, "$DESIRED", desiredPath)
+		args = append(args, strings.ReplaceAll(arg, "$RESULT", resultPath))
+	}
+	logDebug("Running tool: " + strings.Join(args, " "))
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if tty, err := openTerminal(); err == nil {
+		// Stdin may hold <desired_changes>, terminal tools need the terminal
+		defer tty.Close()
+		cmd.Stdin = tty
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	content, err := ioutil.ReadFile(resultPath)
+	if err != nil {
+		return err
+	}
+	if desiredPath == fileBExt.osPathname {
+		loadFileContent(fileBExt)
+	}
+	if !bytes.Equal(content, fileAExt.fileContent) {
+		switch {
+		case resultPath == fileAExt.osPathname:
+			err = stageFile(fileAExt.osPathname)
+		case dryRun:
+			fmt.Printf("Dry-run enabled, skipping file writes: %s\n", fileAExt.osPathname)
+		default:
+			err = writeFileContent(*fileAExt, content)
+		}
+	}
+	fileAExt.fileContent = content
+	fileAExt.fileContentString = string(content)
+	return err
+}
+
+// resolveWithTool runs the --tool on a file and compares the files again,
+// it reports if they are the same now.
+func resolveWithTool(fileAExt *fileInfoExtended, fileBExt *fileInfoExtended, dryRun bool) (bool, error) {
+	countStats(func(stats *trackedStats) { stats.ToolOpened++ })
+	if err := runMergeTool(fileAExt, fileBExt, dryRun); err != nil {
+		return false, err
+	}
+
+	equal := fileAExt.fileContentString == fileBExt.fileContentString
+	if !equal && lineCompareActive() {
+		dmp := diffmatchpatch.New()
+		equal = !diffHasChanges(diffLineMode(dmp, fileAExt.fileContentString, fileBExt.fileContentString))
+	}
+	if equal {
+		countStats(func(stats *trackedStats) { stats.ToolResolved++ })
+		fmt.Printf("Resolved with tool: %s\n", fileAExt.osPathname)
+		return true, nil
+	}
+	color.Style{color.OpBold}.Printf("Files still differ after the tool, reviewing the remaining changes\n")
+	return false, nil
+}
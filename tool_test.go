@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseMergeTool(t *testing.T) {
+	tests := []struct {
+		name    string
+		tool    string
+		want    string
+		wantErr bool
+	}{
+		{"Known", "vimdiff", "vimdiff $ORIGINAL $DESIRED", false},
+		{"Command", "code --diff", "code --diff $ORIGINAL $DESIRED", false},
+		{"ThreeWay", "meld $ORIGINAL --output=$RESULT $DESIRED", "meld $ORIGINAL --output=$RESULT $DESIRED", false},
+		{"Empty", " ", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMergeTool(tt.tool)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMergeTool() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("parseMergeTool() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_compareFilesTool(t *testing.T) {
+	defer func() { prompts = nil }()
+	defer func() { mergeToolCommand = nil }()
+	defer func(stats trackedStats) { runtimeStats = stats }(runtimeStats)
+
+	tests := []struct {
+		name         string
+		tool         string
+		answers      string
+		dryRun       bool
+		want         string
+		wantResolved int
+	}{
+		{"TwoWay", "cp $DESIRED $ORIGINAL", "t\n", false, "a\nB\n", 1},
+		{"ThreeWay", "cp $DESIRED $RESULT", "t\n", false, "a\nB\n", 1},
+		{"DryRun", "cp $DESIRED $ORIGINAL", "t\n", true, "a\nb\n", 1},
+		{"StillDiffers", "true", "t\nn\n", false, "a\nb\n", 0},
+		{"Failed", "false", "t\nn\n", false, "a\nb\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "tool")
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			original := writeTestFile(filepath.Join(tmpDir, "a/app.txt"), "a\nb\n")
+			desired := writeTestFile(filepath.Join(tmpDir, "b/app.txt"), "a\nB\n")
+			mergeToolCommand, _ = parseMergeTool(tt.tool)
+			runtimeStats = trackedStats{}
+
+			setAnswers(tt.answers)
+			if _, err := compareFiles(original, desired, tt.dryRun, false); err != nil {
+				t.Fatalf("compareFiles() error = %v", err)
+			}
+			content, _ := ioutil.ReadFile(original.osPathname)
+			if string(content) != tt.want {
+				t.Errorf("compareFiles() = %q, want %q", content, tt.want)
+			}
+			if runtimeStats.ToolOpened != 1 || runtimeStats.ToolResolved != tt.wantResolved {
+				t.Errorf("compareFiles() tool opened %v, resolved %v, want 1, %v", runtimeStats.ToolOpened, runtimeStats.ToolResolved, tt.wantResolved)
+			}
+		})
+	}
+}
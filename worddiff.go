@@ -0,0 +1,80 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gookit/color"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// wordDiffModes are the supported values for --word-diff.
+var wordDiffModes = []string{"color", "plain", "none"}
+
+// wordTokens splits text into words, runs of blanks, newlines and single
+// punctuation characters. Splitting on punctuation means a value like
+// 5.0.6 -> 5.0.8 only highlights the characters that changed.
+var wordTokens = regexp.MustCompile(`[\p{L}\p{N}_]+|[ \t]+|\r?\n|.`)
+
+func validWordDiffMode(name string) bool {
+	for _, mode := range wordDiffModes {
+		if mode == name {
+			return true
+		}
+	}
+	return false
+}
+
+// diffWords runs a second, word level, diff over a deleted and inserted block of lines.
+func diffWords(dmp *diffmatchpatch.DiffMatchPatch, deleted string, inserted string) []diffmatchpatch.Diff {
+	tokensA := wordTokens.FindAllString(deleted, -1)
+	tokensB := wordTokens.FindAllString(inserted, -1)
+
+	identity := func(token string) string { return token }
+	keyRunes := make(map[string]rune)
+	runesA := tokensToRunes(tokensA, keyRunes, identity)
+	runesB := tokensToRunes(tokensB, keyRunes, identity)
+
+	runeDiffs := dmp.DiffMainRunes(runesA, runesB, false)
+	runeDiffs = dmp.DiffCleanupSemantic(runeDiffs)
+
+	return runeDiffsToText(runeDiffs, tokensA, tokensB)
+}
+
+// wordDiffString shows a deleted and inserted block as a single block with the
+// changed words marked, either coloured like git --color-words or with
+// [-removed-]{+added+} markers like git --word-diff=plain.
+func wordDiffString(dmp *diffmatchpatch.DiffMatchPatch, deleted string, inserted string, mode string) string {
+	out := ""
+	for _, diff := range diffWords(dmp, deleted, inserted) {
+		switch {
+		case mode == "plain" && diff.Type == diffmatchpatch.DiffDelete:
+			out += "[-" + diff.Text + "-]"
+		case mode == "plain" && diff.Type == diffmatchpatch.DiffInsert:
+			out += "{+" + diff.Text + "+}"
+		case mode == "plain":
+			out += diff.Text
+		case diff.Type == diffmatchpatch.DiffDelete:
+			out += colorLines(diff.Text, color.Style{color.Red, color.OpUnderscore})
+		case diff.Type == diffmatchpatch.DiffInsert:
+			out += colorLines(diff.Text, color.Style{color.Green, color.OpUnderscore})
+		default:
+			out += colorLines(diff.Text, color.Style{color.White})
+		}
+	}
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return out
+}
+
+// colorLines colours every line on its own so the colour does not bleed past a newline.
+func colorLines(text string, style color.Style) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = style.Sprint(strings.ReplaceAll(line, "\t", "˲   "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
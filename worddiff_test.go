@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func Test_validWordDiffMode(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"color", true},
+		{"plain", true},
+		{"none", true},
+		{"words", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validWordDiffMode(tt.name); got != tt.want {
+				t.Errorf("validWordDiffMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_wordDiffString(t *testing.T) {
+	dmp := diffmatchpatch.New()
+	tests := []struct {
+		name     string
+		deleted  string
+		inserted string
+		want     string
+	}{
+		{"Value", "  node_type = \"cache.t3.small\"\n", "  node_type = \"cache.m5.large\"\n", "  node_type = \"cache.[-t3.small-]{+m5.large+}\"\n"},
+		{"Version", "  engine_version = \"5.0.6\"\n", "  engine_version = \"5.0.8\"\n", "  engine_version = \"5.0.[-6-]{+8+}\"\n"},
+		{"TwoLines", "a = 1\nb = true\n", "a = 2\nb = true\n", "a = [-1-]{+2+}\nb = true\n"},
+		{"AddedWord", "tags = local\n", "tags = local.common\n", "tags = local{+.common+}\n"},
+		{"NoNewline", "a = 1", "a = 2", "a = [-1-]{+2+}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wordDiffString(dmp, tt.deleted, tt.inserted, "plain"); got != tt.want {
+				t.Errorf("wordDiffString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlGlobs are the files compared as YAML.
+var yamlGlobs = []string{"*.yaml", "*.yml"}
+
+// textSource finds lines and offsets in the text a node was parsed from.
+type textSource struct {
+	text       string
+	lineStarts []int
+}
+
+func newTextSource(text string) textSource {
+	lineStarts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' && i+1 < len(text) {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	return textSource{text: text, lineStarts: lineStarts}
+}
+
+// lineStart returns the offset of a line, one based, or the end of the text past the last line.
+func (s textSource) lineStart(line int) int {
+	if line > len(s.lineStarts) {
+		return len(s.text)
+	}
+	return s.lineStarts[line-1]
+}
+
+// line returns a line without its newline.
+func (s textSource) line(line int) string {
+	return strings.TrimRight(s.text[s.lineStart(line):s.lineStart(line+1)], "\r\n")
+}
+
+// offset returns the offset of a one based line and column, columns count characters.
+func (s textSource) offset(line int, column int) int {
+	offset := s.lineStart(line)
+	for i := 1; i < column && offset < len(s.text); i++ {
+		_, size := utf8.DecodeRuneInString(s.text[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// parseYAMLDocuments parses every document of a YAML stream.
+func parseYAMLDocuments(text string) ([]*yaml.Node, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(text))
+	docs := []*yaml.Node{}
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// equalYAMLNodes compares the values of two nodes, ignoring style, comments and key order.
+func equalYAMLNodes(a *yaml.Node, b *yaml.Node) bool {
+	if a.Kind != b.Kind {
+		return false
+	}
+	switch a.Kind {
+	case yaml.ScalarNode:
+		return a.ShortTag() == b.ShortTag() && a.Value == b.Value
+	case yaml.AliasNode:
+		return a.Value == b.Value
+	case yaml.MappingNode:
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+		for i := 0; i < len(a.Content); i += 2 {
+			bValue := yamlMappingValue(b, a.Content[i].Value)
+			if bValue == nil || !equalYAMLNodes(a.Content[i+1], bValue) {
+				return false
+			}
+		}
+		return true
+	}
+	if len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !equalYAMLNodes(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlMappingValue returns the value of a key in a mapping, nil when missing.
+func yamlMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if i := yamlMappingIndex(mapping, key); i != -1 {
+		return mapping.Content[i+1]
+	}
+	return nil
+}
+
+// yamlMappingIndex returns the index of a key in the content of a mapping, -1 when missing.
+func yamlMappingIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlDiffer compares the documents of two YAML files.
+type yamlDiffer struct {
+	srcA textSource
+	srcB textSource
+}
+
+// diffYAML returns the changes that turn the original into the desired
+// changes key by key, false when the files are not valid YAML or can only
+// be compared line by line.
+func diffYAML(textA string, textB string) ([]structChange, bool) {
+	docsA, err := parseYAMLDocuments(textA)
+	if err != nil {
+		logDebug("Not comparing as YAML: " + err.Error())
+		return nil, false
+	}
+	docsB, err := parseYAMLDocuments(textB)
+	if err != nil {
+		logDebug("Not comparing as YAML: " + err.Error())
+		return nil, false
+	}
+	if len(docsA) != len(docsB) || len(docsA) == 0 {
+		return nil, false
+	}
+
+	d := yamlDiffer{srcA: newTextSource(textA), srcB: newTextSource(textB)}
+	changes := []structChange{}
+	for i := range docsA {
+		if len(docsA[i].Content) == 0 || len(docsB[i].Content) == 0 {
+			if len(docsA[i].Content) != len(docsB[i].Content) {
+				return nil, false
+			}
+			continue
+		}
+		path := ""
+		if len(docsA) > 1 {
+			path = fmt.Sprintf("document %d: ", i+1)
+		}
+		docChanges, ok := d.diffNode(path, docsA[i].Content[0], docsB[i].Content[0], false)
+		if !ok {
+			return nil, false
+		}
+		changes = append(changes, docChanges...)
+	}
+	return changes, true
+}
+
+// joinYAMLPath adds a key to a path, spec + replicas is spec.replicas.
+func joinYAMLPath(path string, key string) string {
+	if path == "" || strings.HasSuffix(path, " ") {
+		return path + key
+	}
+	return path + "." + key
+}
+
+// diffNode returns the changes between two values. It returns false when
+// the changes can not be made inside the value, the caller then replaces it whole.
+func (d yamlDiffer) diffNode(path string, a *yaml.Node, b *yaml.Node, flow bool) ([]structChange, bool) {
+	if equalYAMLNodes(a, b) {
+		return nil, true
+	}
+	if a.Kind != b.Kind {
+		return nil, false
+	}
+
+	switch a.Kind {
+	case yaml.ScalarNode:
+		change, ok := d.scalarChange(path, a, b, flow)
+		return []structChange{change}, ok
+	case yaml.MappingNode:
+		return d.diffMapping(path, a, b, flow || a.Style&yaml.FlowStyle != 0)
+	case yaml.SequenceNode:
+		if len(a.Content) != len(b.Content) {
+			return nil, false
+		}
+		changes := []structChange{}
+		for i := range a.Content {
+			itemChanges, ok := d.diffNode(fmt.Sprintf("%s[%d]", path, i), a.Content[i], b.Content[i], flow || a.Style&yaml.FlowStyle != 0)
+			if !ok {
+				return nil, false
+			}
+			changes = append(changes, itemChanges...)
+		}
+		return changes, true
+	}
+	return nil, false
+}
+
+// diffMapping compares two mappings key by key, added, removed and replaced
+// keys are only edited in block mappings.
+func (d yamlDiffer) diffMapping(path string, a *yaml.Node, b *yaml.Node, flow bool) ([]structChange, bool) {
+	changes := []structChange{}
+	lastKeyA := -1
+
+	for i := 0; i < len(b.Content); i += 2 {
+		keyB, valueB := b.Content[i], b.Content[i+1]
+		keyPath := joinYAMLPath(path, keyB.Value)
+		iA := yamlMappingIndex(a, keyB.Value)
+
+		if iA == -1 {
+			if flow || len(a.Content) == 0 {
+				return nil, false
+			}
+			change, ok := d.addPair(keyPath, a, lastKeyA, keyB, valueB)
+			if !ok {
+				return nil, false
+			}
+			changes = append(changes, change)
+			continue
+		}
+
+		lastKeyA = iA
+		keyChanges, ok := d.diffNode(keyPath, a.Content[iA+1], valueB, flow)
+		if !ok {
+			if flow {
+				return nil, false
+			}
+			change, ok := d.replacePair(keyPath, a.Content[iA], a.Content[iA+1], keyB, valueB)
+			if !ok {
+				return nil, false
+			}
+			keyChanges = []structChange{change}
+		}
+		changes = append(changes, keyChanges...)
+	}
+
+	for i := 0; i < len(a.Content); i += 2 {
+		keyA := a.Content[i]
+		if yamlMappingIndex(b, keyA.Value) != -1 {
+			continue
+		}
+		if flow {
+			return nil, false
+		}
+		start, end, atLineStart := d.pairExtent(d.srcA, keyA)
+		if !atLineStart {
+			return nil, false
+		}
+		changes = append(changes, structChange{
+			kind:   keyRemoved,
+			path:   joinYAMLPath(path, keyA.Value),
+			before: d.valueText(d.srcA, keyA, a.Content[i+1]),
+			start:  start,
+			end:    end,
+		})
+	}
+
+	return changes, true
+}
+
+// scalarChange replaces a scalar in place with the scalar as written in the desired changes.
+func (d yamlDiffer) scalarChange(path string, a *yaml.Node, b *yaml.Node, flow bool) (structChange, bool) {
+	startA, endA, okA := scalarSpan(d.srcA, a, flow)
+	startB, endB, okB := scalarSpan(d.srcB, b, flow)
+	if !okA || !okB {
+		return structChange{}, false
+	}
+	return structChange{
+		kind:   keyChanged,
+		path:   path,
+		before: d.srcA.text[startA:endA],
+		after:  d.srcB.text[startB:endB],
+		start:  startA,
+		end:    endA,
+		text:   d.srcB.text[startB:endB],
+	}, true
+}
+
+// scalarSpan returns where a single line scalar is written, false for
+// block scalars and scalars spread over more than one line.
+func scalarSpan(src textSource, node *yaml.Node, flow bool) (int, int, bool) {
+	if node.Kind != yaml.ScalarNode || node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 || node.Line == 0 {
+		return 0, 0, false
+	}
+	start := src.offset(node.Line, node.Column)
+	rest := src.text[start : src.lineStart(node.Line)+len(src.line(node.Line))]
+
+	switch {
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		if !strings.HasPrefix(rest, "\"") {
+			return 0, 0, false
+		}
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' {
+				i++
+			} else if rest[i] == '"' {
+				return start, start + i + 1, true
+			}
+		}
+		return 0, 0, false
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		if !strings.HasPrefix(rest, "'") {
+			return 0, 0, false
+		}
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\'' {
+				if i+1 < len(rest) && rest[i+1] == '\'' {
+					i++
+					continue
+				}
+				return start, start + i + 1, true
+			}
+		}
+		return 0, 0, false
+	}
+
+	end := len(rest)
+	if i := strings.Index(rest, " #"); i != -1 {
+		end = i
+	}
+	if flow {
+		if i := strings.IndexAny(rest[:end], ",]}"); i != -1 {
+			end = i
+		}
+	}
+	value := strings.TrimRight(rest[:end], " \t")
+	if value == "" || value != node.Value {
+		// Empty, tagged or continued on the next line
+		return 0, 0, false
+	}
+	return start, start + len(value), true
+}
+
+// pairExtent returns the lines of a key and its value, from the start of
+// the key line to the start of the line after the value. Blank and comment
+// lines after the value are left to the next key. atLineStart is false when
+// other text comes before the key on its line, such as the dash of a list item.
+func (d yamlDiffer) pairExtent(src textSource, key *yaml.Node) (int, int, bool) {
+	keyStart := src.offset(key.Line, key.Column)
+	atLineStart := strings.TrimSpace(src.text[src.lineStart(key.Line):keyStart]) == ""
+	indent := key.Column - 1
+
+	last := key.Line
+	for line := key.Line + 1; line <= len(src.lineStarts); line++ {
+		text := src.line(line)
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lineIndent := len(text) - len(strings.TrimLeft(text, " "))
+		if lineIndent > indent || (lineIndent == indent && (trimmed == "-" || strings.HasPrefix(trimmed, "- "))) {
+			last = line
+			continue
+		}
+		break
+	}
+
+	start := keyStart
+	if atLineStart {
+		start = src.lineStart(key.Line)
+	}
+	return start, src.lineStart(last + 1), atLineStart
+}
+
+// pairText returns a key and its value as written in src, starting at the
+// key and indented to column indent.
+func (d yamlDiffer) pairText(src textSource, key *yaml.Node, indent int) string {
+	_, end, _ := d.pairExtent(src, key)
+	text := src.text[src.offset(key.Line, key.Column):end]
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	from := key.Column - 1
+	out := ""
+	for i, line := range splitLinesKeepEnds(text) {
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		switch {
+		case i == 0:
+			out += strings.Repeat(" ", indent) + line
+		case lineIndent >= from && strings.TrimSpace(line) != "":
+			out += strings.Repeat(" ", indent) + line[from:]
+		default:
+			out += line
+		}
+	}
+	return out
+}
+
+// valueText returns the value of a key as written in src, for review.
+func (d yamlDiffer) valueText(src textSource, key *yaml.Node, value *yaml.Node) string {
+	if start, end, ok := scalarSpan(src, value, false); ok {
+		return src.text[start:end]
+	}
+	return strings.TrimSuffix(d.pairText(src, key, 0), "\n")
+}
+
+// replacePair replaces a key and its whole value with the pair from the desired changes.
+func (d yamlDiffer) replacePair(path string, keyA *yaml.Node, valueA *yaml.Node, keyB *yaml.Node, valueB *yaml.Node) (structChange, bool) {
+	start, end, atLineStart := d.pairExtent(d.srcA, keyA)
+	if !atLineStart {
+		return structChange{}, false
+	}
+	return structChange{
+		kind:   keyChanged,
+		path:   path,
+		before: d.valueText(d.srcA, keyA, valueA),
+		after:  d.valueText(d.srcB, keyB, valueB),
+		start:  start,
+		end:    end,
+		text:   d.pairText(d.srcB, keyB, keyA.Column-1),
+	}, true
+}
+
+// addPair inserts a key from the desired changes after the key it follows
+// there, or before the first key when it comes first.
+func (d yamlDiffer) addPair(path string, a *yaml.Node, lastKeyA int, keyB *yaml.Node, valueB *yaml.Node) (structChange, bool) {
+	firstKey := a.Content[0]
+	offset := 0
+	switch {
+	case lastKeyA != -1:
+		_, offset, _ = d.pairExtent(d.srcA, a.Content[lastKeyA])
+	default:
+		start, end, atLineStart := d.pairExtent(d.srcA, firstKey)
+		offset = start
+		if !atLineStart {
+			offset = end
+		}
+	}
+
+	text := d.pairText(d.srcB, keyB, firstKey.Column-1)
+	if offset == len(d.srcA.text) && !strings.HasSuffix(d.srcA.text, "\n") {
+		text = "\n" + strings.TrimSuffix(text, "\n")
+	}
+	return structChange{
+		kind:  keyAdded,
+		path:  path,
+		after: d.valueText(d.srcB, keyB, valueB),
+		start: offset,
+		end:   offset,
+		text:  text,
+	}, true
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_yamlGlobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     bool
+	}{
+		{"Yaml", "deploy.yaml", true},
+		{"Yml", ".gitlab-ci.YML", true},
+		{"Text", "deploy.txt", false},
+		{"NoExt", "yaml", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchGlobs(yamlGlobs, tt.fileName); got != tt.want {
+				t.Errorf("matchGlobs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diffYAML(t *testing.T) {
+	original := `# Deployment for web
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: 2 # scaled by hand
+  template:
+    spec:
+      containers:
+        - name: web
+          image: "web:1.0"
+          ports: [80, 443]
+
+  selector:
+    app: web
+`
+
+	tests := []struct {
+		name      string
+		desired   string
+		wantOk    bool
+		wantPaths []string
+		want      string
+	}{
+		{
+			"Reordered",
+			"kind: Deployment\napiVersion: apps/v1\nspec:\n    selector: {app: web}\n    replicas: 2\n    template:\n        spec:\n            containers:\n            - image: web:1.0\n              name: web\n              ports:\n              - 80\n              - 443\n",
+			true, []string{}, original,
+		},
+		{
+			"Scalar",
+			"apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 3\n  template:\n    spec:\n      containers:\n      - name: web\n        image: 'web:1.1'\n        ports: [80, 8443]\n  selector:\n    app: web\n",
+			true, []string{"spec.replicas", "spec.template.spec.containers[0].image", "spec.template.spec.containers[0].ports[1]"},
+			`# Deployment for web
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: 3 # scaled by hand
+  template:
+    spec:
+      containers:
+        - name: web
+          image: 'web:1.1'
+          ports: [80, 8443]
+
+  selector:
+    app: web
+`,
+		},
+		{
+			"AddedAndRemoved",
+			"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 2\n  template:\n    spec:\n      containers:\n      - name: web\n        image: web:1.0\n        ports: [80, 443]\n",
+			true, []string{"metadata", "spec.selector"},
+			`# Deployment for web
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2 # scaled by hand
+  template:
+    spec:
+      containers:
+        - name: web
+          image: "web:1.0"
+          ports: [80, 443]
+
+`,
+		},
+		{
+			"ListReplaced",
+			"apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 2\n  template:\n    spec:\n      containers:\n      - name: web\n        image: web:1.0\n        ports: [80, 443]\n      - name: proxy\n        image: proxy:2\n  selector:\n    app: web\n",
+			true, []string{"spec.template.spec.containers"},
+			`# Deployment for web
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: 2 # scaled by hand
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1.0
+        ports: [80, 443]
+      - name: proxy
+        image: proxy:2
+
+  selector:
+    app: web
+`,
+		},
+		{"Invalid", "spec: [\n", false, nil, ""},
+		{"RootKind", "- a\n- b\n", false, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, ok := diffYAML(original, tt.desired)
+			if ok != tt.wantOk {
+				t.Fatalf("diffYAML() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			paths := []string{}
+			for _, change := range changes {
+				paths = append(paths, change.path)
+			}
+			if len(paths) != len(tt.wantPaths) {
+				t.Fatalf("diffYAML() paths = %v, want %v", paths, tt.wantPaths)
+			}
+			for i := range paths {
+				if paths[i] != tt.wantPaths[i] {
+					t.Errorf("diffYAML() paths = %v, want %v", paths, tt.wantPaths)
+				}
+			}
+			if got := applyStructChanges(original, changes); got != tt.want {
+				t.Errorf("applyStructChanges() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_diffYAMLDocuments(t *testing.T) {
+	original := "a: 1\n---\nb: 2\n"
+	changes, ok := diffYAML(original, "a: 1\n---\nb: 3\n")
+	if !ok || len(changes) != 1 || changes[0].path != "document 2: b" {
+		t.Fatalf("diffYAML() = %v, %v, want one change to document 2: b", changes, ok)
+	}
+	if got := applyStructChanges(original, changes); got != "a: 1\n---\nb: 3\n" {
+		t.Errorf("applyStructChanges() = %q", got)
+	}
+
+	if _, ok := diffYAML(original, "a: 1\n"); ok {
+		t.Errorf("diffYAML() with a missing document ok = true, want false")
+	}
+}
+
+func Test_compareFilesYAML(t *testing.T) {
+	defer func() { prompts = nil }()
+
+	tmpDir, err := ioutil.TempDir("", "yaml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	original := writeTestFile(filepath.Join(tmpDir, "a/values.yaml"), "# sizes\nreplicas: 2\nimage: web:1.0 # pinned\n")
+	desired := writeTestFile(filepath.Join(tmpDir, "b/values.yaml"), "image: web:1.1\nreplicas: 3\n")
+
+	// Review the file, take the image and skip the replicas
+	setAnswers("y\ny\nn\n")
+	equal, err := compareFiles(original, desired, false, false)
+	if err != nil || equal {
+		t.Errorf("compareFiles() = %v, %v, want false", equal, err)
+	}
+	content, _ := ioutil.ReadFile(original.osPathname)
+	if want := "# sizes\nreplicas: 2\nimage: web:1.1 # pinned\n"; string(content) != want {
+		t.Errorf("compareFiles() = %q, want %q", content, want)
+	}
+}